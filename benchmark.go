@@ -1,18 +1,91 @@
 package main
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
 	"os/exec"
 	"runtime"
+	"slices"
 	"strings"
 	"time"
 )
 
+// BaselineQuery is executed by every runner against every dataset in order to measure
+// fixed overhead of the process launch and database open
+var BaselineQuery = Query{Name: "startup", Query: "SELECT 1"}
+
 type Benchmark struct {
-	Warmup      int
-	Attempts    int
-	ClearCaches bool
+	Warmup   int
+	Attempts int
+	// CacheModes select cache modes for every dataset (see CacheModesFor); every query is measured in every mode
+	CacheModes []CacheRule
+	// NetTime enables additional net_time measurement with baseline startup time subtracted
+	NetTime bool
+	// Order of the attempts execution across runners and queries (see Plan)
+	Order string
+	// Seed for the shuffled execution order; random seed is generated (and recorded in parameters) if zero
+	Seed int64
+	// Profilers select profiler for every runner and dataset (see ProfilerFor)
+	Profilers []ProfilerRule
+	// Profiling is the default profiling policy for benchmarks which do not set it explicitly
+	Profiling string
+	// BaselineBranch and RegressionThreshold define regressed queries for the ProfilingRegressed policy:
+	// median time must exceed median of the latest finished BaselineBranch benchmark by more than threshold (relative)
+	BaselineBranch      string
+	RegressionThreshold float64
+	// Noise configures checks of the machine noise before the benchmark and every query
+	Noise NoiseConfig
+	// Isolation is applied to every benchmarked (and profiled) process
+	Isolation Isolation
+	// Timeout limits every warmup and measured run (disabled if zero): runner which exceeds it is excluded from the query
+	Timeout time.Duration
+}
+
+// WarningTimeout prefixes warnings recorded for the runners which exceeded Benchmark.Timeout for the query
+const WarningTimeout = "timeout"
+
+// TimeoutError reports run killed after Benchmark.Timeout
+type TimeoutError struct {
+	Timeout time.Duration
+}
+
+func (e *TimeoutError) Error() string {
+	return fmt.Sprintf("%v after %v", WarningTimeout, e.Timeout)
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	if len(sorted)%2 == 1 {
+		return sorted[len(sorted)/2]
+	}
+	return (sorted[len(sorted)/2-1] + sorted[len(sorted)/2]) / 2
+}
+
+// NetTimeResults subtracts startup baseline of the runner from the total_time results; placeholder results of the runners
+// which skipped the query (see WarningSkipped) are not measured and produce no net_time
+func NetTimeResults(results []BenchmarkResult, warnings []Warning, baseline map[string]float64) []BenchmarkResult {
+	skipped := make(map[SampleKey]bool, 0)
+	for _, warning := range warnings {
+		if warning.Message == WarningSkipped {
+			skipped[SampleKey{Runner: warning.Runner, Name: warning.Name, Measurement: MeasurementTotalTime}] = true
+		}
+	}
+	net := make([]BenchmarkResult, 0, len(results))
+	for _, result := range results {
+		if result.Measurement != MeasurementTotalTime || skipped[SampleKey{Runner: result.Runner, Name: result.Name, Measurement: result.Measurement}] {
+			continue
+		}
+		result.Measurement = MeasurementNetTime
+		result.TotalTime = max(0, result.TotalTime-baseline[result.Runner])
+		net = append(net, result)
+	}
+	return net
 }
 
 func clearCaches() error {
@@ -37,30 +110,20 @@ func clearCaches() error {
 	return fmt.Errorf("unable to clear caches for platform '%v'", runtime.GOOS)
 }
 
-func (b *Benchmark) clearCachesIfNeeded() error {
-	if !b.ClearCaches {
-		return nil
+func (b *Benchmark) runCmd(args []string) ([]string, error) {
+	ctx := context.Background()
+	if b.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, b.Timeout)
+		defer cancel()
 	}
-	Logger.Info("clear caches")
-	return clearCaches()
-}
-
-func (b *Benchmark) setParanoid() error {
-	switch runtime.GOOS {
-	case "linux":
-		if err := exec.Command("sh", "-c", "echo '1' | sudo tee /proc/sys/kernel/perf_event_paranoid").Run(); err != nil {
-			return err
-		}
-		return nil
-	case "darwin":
-		return nil
+	cmd := exec.CommandContext(ctx, args[0], args[1:]...)
+	// do not wait for the output of the orphaned children after the process is killed
+	cmd.WaitDelay = time.Second
+	output, err := b.Isolation.CombinedOutput(cmd)
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		return nil, &TimeoutError{Timeout: b.Timeout}
 	}
-	return fmt.Errorf("unable to set paranoid for platform '%v'", runtime.GOOS)
-}
-
-func (b *Benchmark) runCmd(args []string) ([]string, error) {
-	cmd := exec.Command(args[0], args[1:]...)
-	output, err := cmd.CombinedOutput()
 	if err != nil {
 		return nil, fmt.Errorf("err=%w, out=%v", err, string(output))
 	}
@@ -79,58 +142,55 @@ func (b *Benchmark) WarmupCmd(args []string) error {
 	return nil
 }
 
-func (b *Benchmark) RunCmd(args []string) ([]BenchmarkResult, []string, error) {
+// RunAttempt prepares caches according to the mode for the dataset at path and measures single execution of args
+func (b *Benchmark) RunAttempt(args []string, attempt int, cache string, path string) (BenchmarkResult, []string, error) {
+	err := b.PrepareCache(cache, path)
+	if err != nil {
+		return BenchmarkResult{}, nil, fmt.Errorf("failed to prepare %v cache: %w", cache, err)
+	}
+
+	Logger.Infof("running workload #%v/%v (%v cache) cmd %v", attempt+1, b.Attempts, cache, args[:len(args)-1])
+
+	start := time.Now()
+	lines, err := b.runCmd(args)
+	elapsed := time.Since(start)
+	if err != nil {
+		return BenchmarkResult{}, nil, fmt.Errorf("run #%v failed: %w", attempt, err)
+	}
+	return BenchmarkResult{TotalTime: elapsed.Seconds(), Attempts: 1, Cache: cache}, lines, nil
+}
+
+func (b *Benchmark) RunCmd(args []string, cache string, path string) ([]BenchmarkResult, []string, error) {
 	var lines []string
 	var results []BenchmarkResult
 	for i := 0; i < b.Attempts; i++ {
-		err := b.clearCachesIfNeeded()
+		result, output, err := b.RunAttempt(args, i, cache, path)
 		if err != nil {
 			return nil, nil, err
 		}
-
-		Logger.Infof("running workload #%v/%v cmd %v", i+1, b.Attempts, args[:len(args)-1])
-
-		start := time.Now()
-		lines, err = b.runCmd(args)
-		elapsed := time.Since(start)
-
-		results = append(results, BenchmarkResult{
-			TotalTime: elapsed.Seconds(),
-			Attempts:  1,
-		})
-
-		if err != nil {
-			return nil, nil, fmt.Errorf("run #%v failed: %w", i, err)
-		}
+		results = append(results, result)
+		lines = output
 	}
 	return results, lines, nil
 }
 
-func (b *Benchmark) ProfileCmd(args []string) ([]string, error) {
+func (b *Benchmark) ProfileCmd(profiler Profiler, args []string, title string, cache string, path string) ([]string, error) {
+	if _, ok := profiler.(*ProfilerNone); ok {
+		return nil, nil
+	}
 	prefix := fmt.Sprintf("profile-%v-%v", time.Now().Unix(), rand.Intn(1000))
-	profileJson := fmt.Sprintf("%v.json.gz", prefix)
-	profileSym := fmt.Sprintf("%v.json.syms.json", prefix)
-
-	final := make([]string, 0)
-	final = append(final, "samply", "record", "-s", "-o", profileJson, "--unstable-presymbolicate", "--")
-	final = append(final, args...)
 
-	err := b.clearCachesIfNeeded()
+	err := b.PrepareCache(cache, path)
 	if err != nil {
-		return nil, err
+		return nil, fmt.Errorf("failed to prepare %v cache: %w", cache, err)
 	}
-
-	err = b.setParanoid()
+	files, err := profiler.Profile(args, prefix, b.Isolation)
 	if err != nil {
 		return nil, err
 	}
-
-	Logger.Infof("running profile cmd %v", final[:len(final)-1])
-	cmd := exec.Command(final[0], final[1:]...)
-	output, err := cmd.CombinedOutput()
+	rendered, err := RenderProfile(files, prefix, title)
 	if err != nil {
-		return nil, fmt.Errorf("profile command failed: err=%w, out=%v", err, string(output))
+		Logger.Warnf("failed to render flamegraph for %v profile %v: %v", profiler.Name(), prefix, err)
 	}
-
-	return []string{profileJson, profileSym}, nil
+	return append(files, rendered...), nil
 }
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNetTimeResults(t *testing.T) {
+	baseline := map[string]float64{"sqlite3": median([]float64{0.3, 0.1, 0.2}), "turso": median([]float64{0.25, 0.75})}
+	require.Equal(t, map[string]float64{"sqlite3": 0.2, "turso": 0.5}, baseline)
+
+	net := NetTimeResults([]BenchmarkResult{
+		{Runner: "sqlite3", Name: "q", Measurement: MeasurementTotalTime, TotalTime: 1.2, Attempts: 1},
+		{Runner: "turso", Name: "q", Measurement: MeasurementTotalTime, TotalTime: 0.1, Attempts: 1},
+		{Runner: "turso", Name: "q", Measurement: MeasurementNetTime, TotalTime: 0.1, Attempts: 1},
+		{Runner: "duckdb", Name: "q", Measurement: MeasurementTotalTime, TotalTime: 0, Attempts: 1},
+	}, []Warning{{Runner: "duckdb", Name: "q", Message: WarningSkipped}}, baseline)
+	require.Len(t, net, 2)
+	require.Equal(t, MeasurementNetTime, net[0].Measurement)
+	require.InDelta(t, 1.0, net[0].TotalTime, 1e-9)
+	require.Equal(t, 0.0, net[1].TotalTime)
+}
+
+func TestRunCmdTimeout(t *testing.T) {
+	benchmark := Benchmark{Timeout: 100 * time.Millisecond}
+	start := time.Now()
+	_, err := benchmark.runCmd([]string{"sleep", "10"})
+	var timeoutErr *TimeoutError
+	require.ErrorAs(t, err, &timeoutErr)
+	require.Less(t, time.Since(start), 5*time.Second)
+
+	lines, err := benchmark.runCmd([]string{"echo", "ok"})
+	require.Nil(t, err)
+	require.Equal(t, []string{"ok", ""}, lines)
+}
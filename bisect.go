@@ -0,0 +1,276 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"strings"
+)
+
+const (
+	BisectGood = "good"
+	BisectBad  = "bad"
+	BisectSkip = "skip"
+)
+
+// BisectSearch finds first bad commit among count commits ordered from the oldest (the last commit is known to be bad);
+// test classifies the commit and commits which can't be tested are skipped: they are returned if the first bad commit
+// can't be determined exactly because of them
+func BisectSearch(count int, test func(index int) (string, error)) (int, []int, error) {
+	good, bad := -1, count-1
+	skipped := make(map[int]bool)
+	for {
+		candidate := -1
+		middle := float64(good+bad) / 2
+		for i := good + 1; i < bad; i++ {
+			if !skipped[i] && (candidate == -1 || math.Abs(float64(i)-middle) < math.Abs(float64(candidate)-middle)) {
+				candidate = i
+			}
+		}
+		if candidate == -1 {
+			break
+		}
+		verdict, err := test(candidate)
+		if err != nil {
+			return 0, nil, err
+		}
+		switch verdict {
+		case BisectGood:
+			good = candidate
+		case BisectBad:
+			bad = candidate
+		case BisectSkip:
+			skipped[candidate] = true
+		default:
+			return 0, nil, fmt.Errorf("unknown bisect verdict: %v", verdict)
+		}
+	}
+	ambiguous := make([]int, 0)
+	for i := good + 1; i < bad; i++ {
+		ambiguous = append(ambiguous, i)
+	}
+	return bad, ambiguous, nil
+}
+
+// BisectCommits returns commits which are descendants of the good revision and ancestors of the bad revision
+// (including the bad one) ordered from the oldest
+func BisectCommits(repo string, good string, bad string) ([]string, error) {
+	output, err := git(repo, nil, "rev-list", "--reverse", "--ancestry-path", fmt.Sprintf("%v..%v", good, bad))
+	if err != nil {
+		return nil, err
+	}
+	commits := strings.Fields(output)
+	if len(commits) == 0 {
+		return nil, fmt.Errorf("no commits between %v and %v", good, bad)
+	}
+	return commits, nil
+}
+
+// measureRevision builds turso for the revision of the local checkout and measures the query after the noise check;
+// samples are net_time (with the median startup time of the revision subtracted) if Benchmark.NetTime is set
+func (s *System) measureRevision(runner RunnerTurso, benchmark Benchmark, loaded Loaded, query Query, info BenchmarkInfo) ([]float64, error) {
+	instance, err := runner.Init(info)
+	if err != nil {
+		return nil, err
+	}
+	if err := runner.Collect([]Instance{instance}); err != nil {
+		return nil, err
+	}
+	if _, err := benchmark.CheckNoise(info.Dataset, query.Name); err != nil {
+		return nil, err
+	}
+	measure := func(query Query) ([]BenchmarkResult, error) {
+		cmd := instance.RunCmd(loaded.Path, query.Query)
+		if err := benchmark.WarmupCmd(cmd); err != nil {
+			return nil, err
+		}
+		results, _, err := benchmark.RunCmd(cmd, query.Cache, loaded.Path)
+		for i := range results {
+			results[i].Runner, results[i].Name, results[i].Measurement = instance.Name(), query.Name, MeasurementTotalTime
+		}
+		return results, err
+	}
+	results, err := measure(query)
+	if err != nil {
+		return nil, err
+	}
+	if benchmark.NetTime {
+		startup, err := measure(Query{Name: BaselineQuery.Name, Query: BaselineQuery.Query, Cache: query.Cache})
+		if err != nil {
+			return nil, fmt.Errorf("failed to measure startup time: %w", err)
+		}
+		baseline := make([]float64, 0, len(startup))
+		for _, result := range startup {
+			baseline = append(baseline, result.TotalTime)
+		}
+		results = NetTimeResults(results, nil, map[string]float64{instance.Name(): median(baseline)})
+	}
+	samples := make([]float64, 0, len(results))
+	for _, result := range results {
+		samples = append(samples, result.TotalTime)
+	}
+	return samples, nil
+}
+
+// BisectVerdict classifies samples of the commit with Mann-Whitney U tests against samples of the good and bad revisions:
+// commit is bad if it is regressed relative to the good revision and is not faster than the bad one, good in the opposite
+// case and inconclusive (empty verdict) otherwise
+func BisectVerdict(good []float64, bad []float64, current []float64, alpha float64, threshold float64) string {
+	againstGood := CompareSamples(good, current, alpha, threshold)
+	againstBad := CompareSamples(bad, current, alpha, threshold)
+	switch {
+	case againstGood.Verdict == VerdictRegressed && againstBad.Verdict != VerdictImproved:
+		return BisectBad
+	case againstGood.Verdict != VerdictRegressed && againstBad.Verdict == VerdictImproved:
+		return BisectGood
+	}
+	return ""
+}
+
+// CommandBisect finds first commit of the local turso checkout which regressed the query between good and bad revisions
+func (s *System) CommandBisect(args []string) error {
+	flags := flag.NewFlagSet("bisect", flag.ContinueOnError)
+	var (
+		repo      = flags.String("repo", "", "local turso git checkout (TURSO_LOCAL_REPO if not set)")
+		good      = flags.String("good", "", "revision without regression")
+		bad       = flags.String("bad", "", "revision with regression")
+		dataset   = flags.String("dataset", "", "dataset name")
+		query     = flags.String("query", "", "query name")
+		runner    = flags.String("runner", "turso", "turso runner which build configuration is used")
+		attempts  = flags.Int("attempts", 15, "number of attempts for every revision")
+		alpha     = flags.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test")
+		threshold = flags.Float64("threshold", 0.05, "minimal relative regression of median time between good and bad revisions")
+		retries   = flags.Int("retries", 2, "number of additional measurements of the commit which can't be classified before it is skipped")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *good == "" || *bad == "" || *dataset == "" || *query == "" {
+		return fmt.Errorf("good, bad, dataset and query must be set")
+	}
+
+	var turso *RunnerTurso
+	for _, factory := range s.runners {
+		if candidate, ok := factory.(*RunnerTurso); ok && candidate.Name() == *runner {
+			turso = candidate
+			break
+		}
+	}
+	if turso == nil {
+		return fmt.Errorf("turso runner %v is not configured", *runner)
+	}
+	local := *turso
+	if *repo != "" {
+		local.Local = *repo
+	}
+	if local.Local == "" {
+		return fmt.Errorf("local turso checkout must be set with -repo or TURSO_LOCAL_REPO")
+	}
+
+	var target Dataset
+	for _, candidate := range s.datatsets {
+		if candidate.Name() == *dataset {
+			target = candidate
+		}
+	}
+	if target == nil {
+		return fmt.Errorf("unknown dataset: %v", *dataset)
+	}
+	loaded, err := s.LoadDataset(target)
+	if err != nil {
+		return err
+	}
+	// query measured with other than cold cache is selected by its suffixed name (see CacheQueryName)
+	queries := CacheQueries(loaded.Queries, CacheModesFor(s.benchmark.CacheModes, *dataset))
+	var selected *Query
+	for i := range queries {
+		if queries[i].Name == *query {
+			selected = &queries[i]
+		}
+	}
+	if selected == nil {
+		return fmt.Errorf("query %v not found in dataset %v", *query, *dataset)
+	}
+
+	goodRevision, err := git(local.Local, nil, "rev-parse", *good+"^{commit}")
+	if err != nil {
+		return err
+	}
+	badRevision, err := git(local.Local, nil, "rev-parse", *bad+"^{commit}")
+	if err != nil {
+		return err
+	}
+	commits, err := BisectCommits(local.Local, goodRevision, badRevision)
+	if err != nil {
+		return err
+	}
+	benchmark := s.benchmark
+	benchmark.Attempts = *attempts
+	if err := benchmark.Isolation.Setup(); err != nil {
+		return fmt.Errorf("failed to setup isolation: %w", err)
+	}
+	measure := func(revision string) ([]float64, error) {
+		Logger.Infof("bisect: measure %v/%v with %v at %v", *dataset, *query, local.Name(), revision)
+		return s.measureRevision(local, benchmark, loaded, *selected, BenchmarkInfo{Repo: local.Local, Revision: revision, Dataset: *dataset})
+	}
+
+	goodSamples, err := measure(goodRevision)
+	if err != nil {
+		return fmt.Errorf("failed to measure good revision %v: %w", goodRevision, err)
+	}
+	badSamples, err := measure(badRevision)
+	if err != nil {
+		return fmt.Errorf("failed to measure bad revision %v: %w", badRevision, err)
+	}
+	regression := CompareSamples(goodSamples, badSamples, *alpha, *threshold)
+	fmt.Printf("good %v: %.4f, bad %v: %.4f (%+.1f%%, p=%.3f), %v commits to bisect\n",
+		shortRevision(goodRevision), regression.BaseMedian, shortRevision(badRevision), regression.TargetMedian,
+		100*(regression.Ratio-1), regression.PValue, len(commits))
+	if regression.Verdict != VerdictRegressed {
+		return fmt.Errorf("regression of %v/%v is not reproduced between %v and %v", *dataset, *query, goodRevision, badRevision)
+	}
+
+	// commit which can't be classified significantly is measured again (samples are accumulated) and skipped at the end
+	first, ambiguous, err := BisectSearch(len(commits), func(index int) (string, error) {
+		samples := make([]float64, 0)
+		for attempt := 0; attempt <= *retries; attempt++ {
+			current, err := measure(commits[index])
+			var buildErr *BuildError
+			if errors.As(err, &buildErr) {
+				fmt.Printf("%-8v %v: build failed (log at %v)\n", BisectSkip, shortRevision(commits[index]), buildErr.Log)
+				return BisectSkip, nil
+			} else if err != nil {
+				return "", err
+			}
+			samples = append(samples, current...)
+			verdict := BisectVerdict(goodSamples, badSamples, samples, *alpha, *threshold)
+			if verdict != "" {
+				fmt.Printf("%-8v %v: %.4f (%+.1f%% vs good)\n", verdict, shortRevision(commits[index]), median(samples), 100*(median(samples)/regression.BaseMedian-1))
+				return verdict, nil
+			}
+		}
+		fmt.Printf("%-8v %v: %.4f (%+.1f%% vs good) is inconclusive after %v samples\n", BisectSkip, shortRevision(commits[index]), median(samples), 100*(median(samples)/regression.BaseMedian-1), len(samples))
+		return BisectSkip, nil
+	})
+	if err != nil {
+		return err
+	}
+
+	describe := func(revision string) string {
+		subject, err := git(local.Local, nil, "log", "-1", "--format=%s", revision)
+		if err != nil {
+			return revision
+		}
+		return fmt.Sprintf("%v %v", revision, subject)
+	}
+	if len(ambiguous) > 0 {
+		fmt.Printf("\nfirst bad commit can't be determined because of skipped commits, it is one of:\n")
+		for _, index := range append(ambiguous, first) {
+			fmt.Printf("  %v\n", describe(commits[index]))
+		}
+		return nil
+	}
+	fmt.Printf("\nfirst bad commit: %v\n", describe(commits[first]))
+	return nil
+}
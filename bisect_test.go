@@ -0,0 +1,82 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBisectSearch(t *testing.T) {
+	classify := func(firstBad int, skipped ...int) (func(int) (string, error), *[]int) {
+		tested := make([]int, 0)
+		return func(index int) (string, error) {
+			tested = append(tested, index)
+			for _, skip := range skipped {
+				if index == skip {
+					return BisectSkip, nil
+				}
+			}
+			if index >= firstBad {
+				return BisectBad, nil
+			}
+			return BisectGood, nil
+		}, &tested
+	}
+
+	for firstBad := 0; firstBad < 10; firstBad++ {
+		test, tested := classify(firstBad)
+		first, ambiguous, err := BisectSearch(10, test)
+		require.Nil(t, err)
+		require.Equal(t, firstBad, first)
+		require.Empty(t, ambiguous)
+		require.LessOrEqual(t, len(*tested), 4)
+	}
+
+	test, _ := classify(4, 4)
+	first, ambiguous, err := BisectSearch(10, test)
+	require.Nil(t, err)
+	require.Equal(t, 5, first)
+	require.Equal(t, []int{4}, ambiguous)
+
+	test, _ = classify(6, 4)
+	first, ambiguous, err = BisectSearch(10, test)
+	require.Nil(t, err)
+	require.Equal(t, 6, first)
+	require.Empty(t, ambiguous)
+
+	first, ambiguous, err = BisectSearch(1, func(int) (string, error) { panic("nothing to test") })
+	require.Nil(t, err)
+	require.Equal(t, 0, first)
+	require.Empty(t, ambiguous)
+}
+
+func TestBisectCommits(t *testing.T) {
+	repo := t.TempDir()
+	_, err := git(repo, nil, "init", "-q")
+	require.Nil(t, err)
+	commits := make([]string, 0)
+	for _, message := range []string{"c0", "c1", "c2", "c3"} {
+		_, err := git(repo, nil, "-c", "user.name=test", "-c", "user.email=test@test", "commit", "-q", "--allow-empty", "-m", message)
+		require.Nil(t, err)
+		head, err := git(repo, nil, "rev-parse", "HEAD")
+		require.Nil(t, err)
+		commits = append(commits, head)
+	}
+
+	between, err := BisectCommits(repo, commits[0], commits[3])
+	require.Nil(t, err)
+	require.Equal(t, commits[1:], between)
+
+	_, err = BisectCommits(repo, commits[3], commits[0])
+	require.NotNil(t, err)
+}
+
+func TestBisectVerdict(t *testing.T) {
+	good := []float64{1.0, 1.01, 0.99, 1.0, 1.02, 0.98, 1.0, 1.01}
+	bad := []float64{1.5, 1.51, 1.49, 1.5, 1.52, 1.48, 1.5, 1.51}
+	require.Equal(t, BisectGood, BisectVerdict(good, bad, []float64{1.0, 0.99, 1.01, 1.0, 1.0, 1.02, 0.98, 1.0}, 0.05, 0.05))
+	require.Equal(t, BisectBad, BisectVerdict(good, bad, []float64{1.5, 1.49, 1.51, 1.5, 1.5, 1.52, 1.48, 1.5}, 0.05, 0.05))
+	// commit between good and bad revisions and too few samples are inconclusive
+	require.Equal(t, "", BisectVerdict(good, bad, []float64{1.25, 1.24, 1.26, 1.25, 1.25, 1.26, 1.24, 1.25}, 0.05, 0.05))
+	require.Equal(t, "", BisectVerdict(good, bad, []float64{1.5}, 0.05, 0.05))
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
+)
+
+// BuildCache keeps shared cargo target directory and finished binaries addressed by the build parameters hash;
+// downloaded archives, unpacked source trees, binaries and the target directory are evicted in LRU order when
+// total size exceeds the Limit
+type BuildCache struct {
+	Path string
+	// Limit is the size limit in bytes (zero means no limit)
+	Limit int64
+}
+
+func CacheKey(parts ...string) string {
+	hash := sha256.Sum256([]byte(strings.Join(parts, "\x00")))
+	return hex.EncodeToString(hash[:8])
+}
+
+func (c *BuildCache) TargetDir() string { return path.Join(c.Path, "cache", "target") }
+func (c *BuildCache) binaries() string  { return path.Join(c.Path, "cache", "bin") }
+
+// Lookup returns path to the cached binary and marks it as recently used
+func (c *BuildCache) Lookup(key string, name string) (string, bool) {
+	binary := path.Join(c.binaries(), key, name)
+	if _, err := os.Stat(binary); err != nil {
+		return "", false
+	}
+	c.Touch(path.Join(c.binaries(), key))
+	return binary, true
+}
+
+// Store atomically copies built binary to the cache under the given key
+func (c *BuildCache) Store(key string, name string, binary string) (string, error) {
+	dir := path.Join(c.binaries(), key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	source, err := os.Open(binary)
+	if err != nil {
+		return "", err
+	}
+	defer source.Close()
+	tmp, err := os.CreateTemp(dir, name+"-tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = io.Copy(tmp, source)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0o755); err != nil {
+		return "", err
+	}
+	target := path.Join(dir, name)
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Put atomically writes auxiliary file (e.g. build log) next to the cached binary
+func (c *BuildCache) Put(key string, name string, data []byte) (string, error) {
+	dir := path.Join(c.binaries(), key)
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp(dir, name+"-tmp")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmp.Name())
+	_, err = tmp.Write(data)
+	if err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	target := path.Join(dir, name)
+	if err := os.Rename(tmp.Name(), target); err != nil {
+		return "", err
+	}
+	return target, nil
+}
+
+// Get reads auxiliary file stored with Put
+func (c *BuildCache) Get(key string, name string) (string, []byte, error) {
+	target := path.Join(c.binaries(), key, name)
+	data, err := os.ReadFile(target)
+	return target, data, err
+}
+
+func (c *BuildCache) Touch(paths ...string) {
+	now := time.Now()
+	for _, p := range paths {
+		if err := os.Chtimes(p, now, now); err != nil && !os.IsNotExist(err) {
+			Logger.Warnf("failed to touch cache entry %v: %v", p, err)
+		}
+	}
+}
+
+type cacheEntry struct {
+	path string
+	size int64
+	used time.Time
+}
+
+func (c *BuildCache) entries() ([]cacheEntry, error) {
+	candidates := make([]string, 0)
+	for _, pattern := range []string{
+		path.Join(c.Path, "benchmark-turso-*"),
+		path.Join(c.binaries(), "*"),
+	} {
+		matches, err := filepath.Glob(pattern)
+		if err != nil {
+			return nil, err
+		}
+		for _, match := range matches {
+			// temporary files and directories are in progress and build logs are moved to the binaries on success
+			base := filepath.Base(match)
+			if strings.Contains(base, "-tmp") || strings.HasSuffix(base, ".log") {
+				continue
+			}
+			candidates = append(candidates, match)
+		}
+	}
+	if _, err := os.Stat(c.TargetDir()); err == nil {
+		candidates = append(candidates, c.TargetDir())
+	}
+	entries := make([]cacheEntry, 0, len(candidates))
+	for _, candidate := range candidates {
+		info, err := os.Stat(candidate)
+		if err != nil {
+			return nil, err
+		}
+		entry := cacheEntry{path: candidate, used: info.ModTime()}
+		err = filepath.WalkDir(candidate, func(_ string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if d.Type().IsRegular() {
+				info, err := d.Info()
+				if err != nil {
+					return err
+				}
+				entry.size += info.Size()
+			}
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	return entries, nil
+}
+
+// Collect removes least recently used entries (except the keep ones) until cache fits into the Limit
+func (c *BuildCache) Collect(keep ...string) error {
+	if c.Limit <= 0 {
+		return nil
+	}
+	entries, err := c.entries()
+	if err != nil {
+		return err
+	}
+	total := int64(0)
+	for _, entry := range entries {
+		total += entry.size
+	}
+	slices.SortFunc(entries, func(a, b cacheEntry) int { return a.used.Compare(b.used) })
+	for _, entry := range entries {
+		if total <= c.Limit {
+			break
+		}
+		if slices.Contains(keep, entry.path) {
+			continue
+		}
+		Logger.Infof("evict cache entry %v (size %v, used %v)", entry.path, entry.size, entry.used)
+		if err := os.RemoveAll(entry.path); err != nil {
+			return err
+		}
+		total -= entry.size
+	}
+	return nil
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"slices"
+	"strings"
+)
+
+const (
+	// CacheCold drops all OS caches before every attempt (requires sudo on linux); empty mode means CacheCold as well
+	CacheCold = "cold"
+	// CacheColdFile evicts only the dataset file from the page cache with posix_fadvise(DONTNEED) which needs no root;
+	// binaries and shared libraries of the runners stay cached
+	CacheColdFile = "cold-file"
+	// CacheWarm reads the dataset file before every attempt so it is in the page cache
+	CacheWarm = "warm"
+	// CacheHot leaves caches as they are after warmup runs and previous attempts
+	CacheHot = "hot"
+)
+
+// CacheRule selects cache modes for the dataset; empty or "*" dataset matches everything
+type CacheRule struct {
+	Dataset string
+	Modes   []string
+}
+
+func ValidateCacheMode(mode string) error {
+	switch mode {
+	case CacheCold, CacheColdFile, CacheWarm, CacheHot:
+		return nil
+	}
+	return fmt.Errorf("unknown cache mode: %v", mode)
+}
+
+// ParseCacheModes parses comma-separated list of rules in the format [dataset=]mode[+mode...],
+// for example "cold-file,clickhouse=cold-file+warm"; first matching rule wins
+func ParseCacheModes(spec string) ([]CacheRule, error) {
+	rules := make([]CacheRule, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		dataset, value, ok := strings.Cut(item, "=")
+		if !ok {
+			dataset, value = "*", dataset
+		}
+		modes := make([]string, 0)
+		for _, mode := range strings.Split(value, "+") {
+			mode = strings.TrimSpace(mode)
+			if err := ValidateCacheMode(mode); err != nil {
+				return nil, err
+			}
+			if !slices.Contains(modes, mode) {
+				modes = append(modes, mode)
+			}
+		}
+		rules = append(rules, CacheRule{Dataset: strings.TrimSpace(dataset), Modes: modes})
+	}
+	return rules, nil
+}
+
+// CacheModesFor returns cache modes of the dataset (CacheCold if no rule matches)
+func CacheModesFor(rules []CacheRule, dataset string) []string {
+	for _, rule := range rules {
+		if ruleMatches(rule.Dataset, dataset) {
+			return rule.Modes
+		}
+	}
+	return []string{CacheCold}
+}
+
+// CacheQueryName returns name under which query measured with the cache mode is stored: CacheCold measurements keep
+// plain name (as before cache modes were introduced) and other modes are suffixed, so numbers of different modes
+// coexist for the same query in results, reports and history (the mode itself is kept in the cache column)
+func CacheQueryName(name string, mode string) string {
+	if mode == CacheCold || mode == "" {
+		return name
+	}
+	return fmt.Sprintf("%v@%v", name, mode)
+}
+
+// CacheQueries returns copy of every query for every cache mode
+func CacheQueries(queries []Query, modes []string) []Query {
+	expanded := make([]Query, 0, len(queries)*len(modes))
+	for _, mode := range modes {
+		for _, query := range queries {
+			query.Name, query.Cache = CacheQueryName(query.Name, mode), mode
+			expanded = append(expanded, query)
+		}
+	}
+	return expanded
+}
+
+// datasetFiles returns database file with its WAL (if exists)
+func datasetFiles(path string) []string {
+	files := []string{path}
+	if _, err := os.Stat(path + "-wal"); err == nil {
+		files = append(files, path+"-wal")
+	}
+	return files
+}
+
+// EvictFile flushes dirty pages of the file and drops it from the page cache
+func EvictFile(path string) error {
+	file, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	// only clean pages are dropped by DONTNEED advice
+	if err := file.Sync(); err != nil {
+		return err
+	}
+	return fadviseDontNeed(file)
+}
+
+// PrereadFile reads the whole file in order to bring it to the page cache
+func PrereadFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	_, err = io.Copy(io.Discard, file)
+	return err
+}
+
+// PrepareCache brings caches to the state of the mode before the attempt over the dataset at path
+func (b *Benchmark) PrepareCache(mode string, path string) error {
+	switch mode {
+	case CacheCold, "":
+		Logger.Info("clear caches")
+		return clearCaches()
+	case CacheColdFile:
+		var errs []error
+		for _, file := range datasetFiles(path) {
+			if err := EvictFile(file); err != nil {
+				errs = append(errs, fmt.Errorf("failed to evict %v from page cache: %w", file, err))
+			}
+		}
+		return errors.Join(errs...)
+	case CacheWarm:
+		for _, file := range datasetFiles(path) {
+			if err := PrereadFile(file); err != nil {
+				return fmt.Errorf("failed to pre-read %v: %w", file, err)
+			}
+		}
+		return nil
+	case CacheHot:
+		return nil
+	}
+	return fmt.Errorf("unknown cache mode: %v", mode)
+}
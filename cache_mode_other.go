@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os"
+	"runtime"
+)
+
+func fadviseDontNeed(_ *os.File) error {
+	return fmt.Errorf("unable to evict file from page cache for platform '%v'", runtime.GOOS)
+}
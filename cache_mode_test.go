@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCacheModes(t *testing.T) {
+	rules, err := ParseCacheModes("cold-file, clickhouse=cold-file+warm+warm")
+	require.Nil(t, err)
+	require.Equal(t, []CacheRule{
+		{Dataset: "*", Modes: []string{CacheColdFile}},
+		{Dataset: "clickhouse", Modes: []string{CacheColdFile, CacheWarm}},
+	}, rules)
+	// first matching rule wins
+	require.Equal(t, []string{CacheColdFile}, CacheModesFor(rules, "clickhouse"))
+
+	rules, err = ParseCacheModes("tpc-h=hot,warm")
+	require.Nil(t, err)
+	require.Equal(t, []string{CacheHot}, CacheModesFor(rules, "tpc-h"))
+	require.Equal(t, []string{CacheWarm}, CacheModesFor(rules, "clickhouse"))
+	require.Equal(t, []string{CacheCold}, CacheModesFor(nil, "clickhouse"))
+
+	for _, invalid := range []string{"lukewarm", "tpc-h=cold+", "tpc-h="} {
+		_, err := ParseCacheModes(invalid)
+		require.NotNil(t, err, invalid)
+	}
+}
+
+func TestCacheQueries(t *testing.T) {
+	queries := []Query{{Name: "q1", Query: "SELECT 1"}, {Name: "q2", Query: "SELECT 2"}}
+	require.Equal(t, []Query{
+		{Name: "q1", Query: "SELECT 1", Cache: CacheCold},
+		{Name: "q2", Query: "SELECT 2", Cache: CacheCold},
+		{Name: "q1@warm", Query: "SELECT 1", Cache: CacheWarm},
+		{Name: "q2@warm", Query: "SELECT 2", Cache: CacheWarm},
+	}, CacheQueries(queries, []string{CacheCold, CacheWarm}))
+	require.Equal(t, "startup@cold-file", CacheQueryName(BaselineQuery.Name, CacheColdFile))
+}
+
+func TestPrepareCache(t *testing.T) {
+	dataset := path.Join(t.TempDir(), "dataset.db")
+	require.Nil(t, os.WriteFile(dataset, make([]byte, 1<<20), 0o644))
+	require.Nil(t, os.WriteFile(dataset+"-wal", make([]byte, 4096), 0o644))
+	require.Equal(t, []string{dataset, dataset + "-wal"}, datasetFiles(dataset))
+
+	benchmark := Benchmark{}
+	require.Nil(t, benchmark.PrepareCache(CacheWarm, dataset))
+	require.Nil(t, benchmark.PrepareCache(CacheHot, dataset))
+	// empty mode is cold as in CacheQueryName
+	require.Equal(t, "q1", CacheQueryName("q1", ""))
+	require.NotNil(t, benchmark.PrepareCache("lukewarm", dataset))
+	require.NotNil(t, benchmark.PrepareCache(CacheColdFile, path.Join(t.TempDir(), "missing.db")))
+	if runtime.GOOS == "linux" {
+		require.Nil(t, benchmark.PrepareCache(CacheColdFile, dataset))
+	}
+}
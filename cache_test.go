@@ -0,0 +1,70 @@
+package main
+
+import (
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestBuildCacheCollect(t *testing.T) {
+	cache := BuildCache{Path: t.TempDir(), Limit: 250}
+
+	binary := path.Join(cache.Path, "tursodb")
+	require.Nil(t, os.WriteFile(binary, make([]byte, 100), 0o644))
+	stored, err := cache.Store("b", "tursodb", binary)
+	require.Nil(t, err)
+
+	old, recent := path.Join(cache.Path, "benchmark-turso-old.zip"), path.Join(cache.Path, "benchmark-turso-recent")
+	require.Nil(t, os.WriteFile(old, make([]byte, 100), 0o644))
+	require.Nil(t, os.MkdirAll(recent, 0o755))
+	require.Nil(t, os.WriteFile(path.Join(recent, "file"), make([]byte, 100), 0o644))
+
+	now := time.Now()
+	require.Nil(t, os.Chtimes(path.Join(cache.Path, "cache", "bin", "b"), now.Add(-3*time.Hour), now.Add(-3*time.Hour)))
+	require.Nil(t, os.Chtimes(old, now.Add(-2*time.Hour), now.Add(-2*time.Hour)))
+	require.Nil(t, os.Chtimes(recent, now.Add(-1*time.Hour), now.Add(-1*time.Hour)))
+
+	require.Nil(t, cache.Collect(path.Join(cache.Path, "cache", "bin", "b")))
+
+	_, err = os.Stat(stored)
+	require.Nil(t, err)
+	_, err = os.Stat(old)
+	require.True(t, os.IsNotExist(err))
+	_, err = os.Stat(recent)
+	require.Nil(t, err)
+
+	found, ok := cache.Lookup("b", "tursodb")
+	require.True(t, ok)
+	require.Equal(t, stored, found)
+}
+
+func TestBuildCacheEntries(t *testing.T) {
+	cache := BuildCache{Path: t.TempDir(), Limit: 1}
+	for _, name := range []string{"benchmark-turso-a-tmp123/file", "benchmark-turso-a-key.log", "cache/target/release/tursodb", "benchmark-turso-a/file"} {
+		require.Nil(t, os.MkdirAll(path.Dir(path.Join(cache.Path, name)), 0o755))
+		require.Nil(t, os.WriteFile(path.Join(cache.Path, name), make([]byte, 10), 0o644))
+	}
+	entries, err := cache.entries()
+	require.Nil(t, err)
+	paths := make([]string, 0)
+	for _, entry := range entries {
+		paths = append(paths, entry.path)
+	}
+	require.ElementsMatch(t, []string{path.Join(cache.Path, "benchmark-turso-a"), cache.TargetDir()}, paths)
+
+	// instances of the running benchmark are kept while the rest is evicted (in-progress entries are never touched)
+	runner := RunnerTurso{Path: cache.Path, CacheLimit: 1}
+	require.Nil(t, runner.Collect([]Instance{&InstanceTurso{Path: cache.Path, Key: "a", Binary: path.Join(cache.binaries(), "a", "tursodb")}}))
+	for name, exists := range map[string]bool{
+		"benchmark-turso-a":         true,
+		"benchmark-turso-a-tmp123":  true,
+		"benchmark-turso-a-key.log": true,
+		"cache/target":              false,
+	} {
+		_, err := os.Stat(path.Join(cache.Path, name))
+		require.Equal(t, exists, err == nil, name)
+	}
+}
@@ -0,0 +1,262 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"time"
+)
+
+// DetectChangePoints returns indices where new segment starts in the series; PELT search minimizes normalized squared
+// error around segment means plus penalty*log(n) for every change point, segments are at least minSize long
+func DetectChangePoints(series []float64, penalty float64, minSize int) []int {
+	n := len(series)
+	minSize = max(minSize, 1)
+	if n < 2*minSize {
+		return nil
+	}
+	sigma := noiseLevel(series)
+	sum, squares := make([]float64, n+1), make([]float64, n+1)
+	for i, value := range series {
+		sum[i+1] = sum[i] + value
+		squares[i+1] = squares[i] + value*value
+	}
+	cost := func(s, t int) float64 {
+		size, total := float64(t-s), sum[t]-sum[s]
+		return math.Max(squares[t]-squares[s]-total*total/size, 0) / (sigma * sigma)
+	}
+	beta := penalty * math.Log(float64(n))
+
+	optimal, last := make([]float64, n+1), make([]int, n+1)
+	for t := 1; t <= n; t++ {
+		optimal[t] = math.Inf(1)
+	}
+	optimal[0] = -beta
+	candidates := []int{0}
+	for t := minSize; t <= n; t++ {
+		last[t] = -1
+		for _, s := range candidates {
+			if t-s < minSize {
+				continue
+			}
+			if value := optimal[s] + cost(s, t) + beta; value < optimal[t] {
+				optimal[t], last[t] = value, s
+			}
+		}
+		pruned := candidates[:0]
+		for _, s := range candidates {
+			if t-s < minSize || optimal[s]+cost(s, t) <= optimal[t] {
+				pruned = append(pruned, s)
+			}
+		}
+		candidates = pruned
+		if !math.IsInf(optimal[t], 1) {
+			candidates = append(candidates, t)
+		}
+	}
+
+	points := make([]int, 0)
+	for t := last[n]; t > 0; t = last[t] {
+		points = append(points, t)
+	}
+	slices.Reverse(points)
+	return points
+}
+
+// noiseLevel estimates standard deviation of the series noise from the median absolute deviation of the
+// consecutive differences which is robust to the level shifts
+func noiseLevel(series []float64) float64 {
+	diffs := make([]float64, 0, len(series))
+	for i := 1; i < len(series); i++ {
+		diffs = append(diffs, series[i]-series[i-1])
+	}
+	center := median(diffs)
+	deviations := make([]float64, 0, len(diffs))
+	for _, diff := range diffs {
+		deviations = append(deviations, math.Abs(diff-center))
+	}
+	// noise floor prevents detection of the negligible shifts in almost constant series
+	return math.Max(1.4826*median(deviations)/math.Sqrt2, 1e-3)
+}
+
+type ChangePoint struct {
+	Dataset string `json:"dataset"`
+	Runner  string `json:"runner"`
+	Name    string `json:"name"`
+	// Revision is the first revision of the new segment
+	Revision   string    `json:"revision"`
+	CommitTime time.Time `json:"commit_time"`
+	// Previous and Next are the neighbouring revisions in the history (bisect between Previous and Revision)
+	Previous string `json:"previous"`
+	Next     string `json:"next,omitempty"`
+	// Before and After are medians of the segments around the change point
+	Before    float64 `json:"before"`
+	After     float64 `json:"after"`
+	Magnitude float64 `json:"magnitude"`
+	// EnvironmentChanged is set if host fingerprint differs between Previous and Revision (e.g. kernel was updated),
+	// so the shift can be caused by the environment rather than by the code
+	EnvironmentChanged bool `json:"environment_changed,omitempty"`
+}
+
+// HistorySeries groups history entries by dataset, runner and query; only latest entry of every revision is kept
+// and series are ordered by commit time if it is known for all entries
+func HistorySeries(entries []HistoryEntry) map[[3]string][]HistoryEntry {
+	series := make(map[[3]string][]HistoryEntry)
+	for _, entry := range entries {
+		key := [3]string{entry.Dataset, entry.Runner, entry.Name}
+		points := series[key]
+		if i := slices.IndexFunc(points, func(point HistoryEntry) bool { return point.Revision == entry.Revision }); i >= 0 {
+			points = slices.Delete(points, i, i+1)
+		}
+		series[key] = append(points, entry)
+	}
+	for _, points := range series {
+		if slices.ContainsFunc(points, func(point HistoryEntry) bool { return point.CommitTime.IsZero() }) {
+			continue
+		}
+		sort.SliceStable(points, func(i, j int) bool { return points[i].CommitTime.Before(points[j].CommitTime) })
+	}
+	return series
+}
+
+// FindChangePoints runs change-point detection over log-scaled medians of the series (so shifts are relative)
+// and keeps only shifts which relative magnitude exceeds threshold
+func FindChangePoints(points []HistoryEntry, penalty float64, minSize int, threshold float64) []ChangePoint {
+	values := make([]float64, 0, len(points))
+	for _, point := range points {
+		values = append(values, math.Log(math.Max(point.Median, 1e-9)))
+	}
+	indices := DetectChangePoints(values, penalty, minSize)
+	bounds := append(append([]int{0}, indices...), len(points))
+	segment := func(k int) float64 {
+		medians := make([]float64, 0)
+		for _, point := range points[bounds[k]:bounds[k+1]] {
+			medians = append(medians, point.Median)
+		}
+		return median(medians)
+	}
+	changes := make([]ChangePoint, 0)
+	for k, index := range indices {
+		before, after := segment(k), segment(k+1)
+		if before == 0 || math.Abs(after/before-1) < threshold {
+			continue
+		}
+		change := ChangePoint{
+			Dataset:    points[index].Dataset,
+			Runner:     points[index].Runner,
+			Name:       points[index].Name,
+			Revision:   points[index].Revision,
+			CommitTime: points[index].CommitTime,
+			Previous:   points[index-1].Revision,
+			Before:     before,
+			After:      after,
+			Magnitude:  after/before - 1,
+
+			EnvironmentChanged: points[index].Fingerprint != points[index-1].Fingerprint,
+		}
+		if index+1 < len(points) {
+			change.Next = points[index+1].Revision
+		}
+		changes = append(changes, change)
+	}
+	return changes
+}
+
+func WriteChangePoints(output io.Writer, changes []ChangePoint) error {
+	_, err := fmt.Fprintf(output, "%-10v %-10v %-10v %-12v %-12v %-12v %-20v %v\n", "magnitude", "before", "after", "previous", "revision", "next", "runner", "query")
+	if err != nil {
+		return err
+	}
+	for _, change := range changes {
+		query := fmt.Sprintf("%v/%v", change.Dataset, change.Name)
+		if change.EnvironmentChanged {
+			query += " (environment changed)"
+		}
+		_, err := fmt.Fprintf(
+			output,
+			"%-10v %-10v %-10v %-12v %-12v %-12v %-20v %v\n",
+			fmt.Sprintf("%+.1f%%", 100*change.Magnitude),
+			fmt.Sprintf("%.4f", change.Before),
+			fmt.Sprintf("%.4f", change.After),
+			shortRevision(change.Previous),
+			shortRevision(change.Revision),
+			shortRevision(change.Next),
+			change.Runner,
+			query,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// CommandChangePoints reports commits of the branch history where query performance shifted
+func CommandChangePoints(storage *Storage, meta string, args []string) error {
+	flags := flag.NewFlagSet("changepoints", flag.ContinueOnError)
+	var (
+		branch      = flags.String("branch", "main", "branch of the analyzed history")
+		host        = flags.String("host", "", "hostname/arch of the analyzed history (host of the latest benchmark of the branch if neither -host nor -fingerprint is set)")
+		fingerprint = flags.String("fingerprint", "", "include history of all hosts with the environment fingerprint")
+		dataset     = flags.String("dataset", "", "analyze only queries of the dataset")
+		runner      = flags.String("runner", "", "analyze only results of the runner")
+		measurement = flags.String("measurement", MeasurementNetTime, "analyzed measurement")
+		limit       = flags.Int("limit", 100, "number of latest revisions in every series")
+		penalty     = flags.Float64("penalty", 3, "penalty for every change point (multiplied by log of the series length)")
+		minSize     = flags.Int("min-size", 3, "minimal number of revisions between change points")
+		threshold   = flags.Float64("threshold", 0.05, "minimal relative shift of the median time")
+		asJson      = flags.Bool("json", false, "print change points as json")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	metaDb, err := storage.ConnectDb(meta)
+	if err != nil {
+		return err
+	}
+	defer metaDb.Close()
+	if *host == "" && *fingerprint == "" {
+		latestHost, latestFingerprint, err := storage.LatestHost(metaDb, *branch)
+		if err != nil {
+			return err
+		}
+		// history ingested before hosts were recorded has no host until backfill
+		*host = latestHost
+		if latestHost == "" {
+			*fingerprint = latestFingerprint
+		}
+	}
+	entries, err := storage.History(metaDb, *branch, *host, *fingerprint, *dataset, *measurement)
+	if err != nil {
+		return err
+	}
+
+	changes := make([]ChangePoint, 0)
+	series := HistorySeries(entries)
+	keys := make([][3]string, 0, len(series))
+	for key := range series {
+		if (*runner == "" || key[1] == *runner) && key[2] != BuildName {
+			keys = append(keys, key)
+		}
+	}
+	sort.Slice(keys, func(i, j int) bool { return slices.Compare(keys[i][:], keys[j][:]) < 0 })
+	for _, key := range keys {
+		points := series[key]
+		points = points[max(0, len(points)-*limit):]
+		changes = append(changes, FindChangePoints(points, *penalty, *minSize, *threshold)...)
+	}
+	sort.SliceStable(changes, func(i, j int) bool { return math.Abs(changes[i].Magnitude) > math.Abs(changes[j].Magnitude) })
+
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(map[string]any{"branch": *branch, "host": *host, "fingerprint": *fingerprint, "changes": changes})
+	}
+	fmt.Printf("change points of %v history on host %v (fingerprint %v, %v series)\n\n", *branch, *host, *fingerprint, len(keys))
+	return WriteChangePoints(os.Stdout, changes)
+}
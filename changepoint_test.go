@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestDetectChangePoints(t *testing.T) {
+	random := rand.New(rand.NewSource(1))
+	series := make([]float64, 0)
+	for i := 0; i < 60; i++ {
+		level := 1.0
+		if i >= 20 {
+			level = 1.5
+		}
+		if i >= 45 {
+			level = 0.8
+		}
+		series = append(series, level+0.02*random.NormFloat64())
+	}
+	require.Equal(t, []int{20, 45}, DetectChangePoints(series, 3, 3))
+
+	flat := make([]float64, 0)
+	for i := 0; i < 60; i++ {
+		flat = append(flat, 1.0+0.02*random.NormFloat64())
+	}
+	require.Empty(t, DetectChangePoints(flat, 3, 3))
+	require.Empty(t, DetectChangePoints([]float64{1, 2}, 3, 3))
+}
+
+func TestFindChangePoints(t *testing.T) {
+	entries := make([]HistoryEntry, 0)
+	start := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 20; i++ {
+		value := 1.0 + 0.01*float64(i%3)
+		fingerprint := "before"
+		if i >= 12 {
+			value *= 1.3
+			fingerprint = "after"
+		}
+		entries = append(entries, HistoryEntry{
+			Revision:   fmt.Sprintf("rev%02d", i),
+			CommitTime: start.Add(time.Duration(i) * time.Hour),
+			Runner:     "turso",
+			Dataset:    "tpch",
+			Name:       "q1",
+			Median:     value,
+
+			Fingerprint: fingerprint,
+		})
+	}
+	// re-run of the revision replaces previous entry and entries are ordered by commit time
+	rerun := entries[5]
+	rerun.Median = 1.0
+	shuffled := []HistoryEntry{entries[19]}
+	shuffled = append(shuffled, entries[:19]...)
+	entries = append(shuffled, rerun)
+
+	series := HistorySeries(entries)
+	points := series[[3]string{"tpch", "turso", "q1"}]
+	require.Len(t, points, 20)
+	require.Equal(t, "rev00", points[0].Revision)
+	require.Equal(t, "rev19", points[19].Revision)
+
+	changes := FindChangePoints(points, 3, 3, 0.05)
+	require.Len(t, changes, 1)
+	require.Equal(t, "rev12", changes[0].Revision)
+	require.Equal(t, "rev11", changes[0].Previous)
+	require.Equal(t, "rev13", changes[0].Next)
+	require.InDelta(t, 0.3, changes[0].Magnitude, 0.01)
+	require.True(t, changes[0].EnvironmentChanged)
+
+	require.Empty(t, FindChangePoints(points, 3, 3, 0.5))
+}
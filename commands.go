@@ -0,0 +1,23 @@
+package main
+
+import "fmt"
+
+// RunCommand executes one-shot command instead of the benchmark runner loop
+func RunCommand(system *System, name string, args []string) error {
+	storage, meta := &system.storage, system.meta
+	switch name {
+	case "profile-diff":
+		return CommandProfileDiff(storage, meta, args)
+	case "compare":
+		return CommandCompare(storage, meta, args)
+	case "report":
+		return CommandReport(storage, meta, args)
+	case "backfill":
+		return CommandBackfill(storage, meta, system.commitTimes, args)
+	case "changepoints":
+		return CommandChangePoints(storage, meta, args)
+	case "bisect":
+		return system.CommandBisect(args)
+	}
+	return fmt.Errorf("unknown command: %v", name)
+}
@@ -0,0 +1,356 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"math"
+	"os"
+	"slices"
+	"sort"
+	"strings"
+)
+
+const (
+	VerdictImproved  = "improved"
+	VerdictRegressed = "regressed"
+	VerdictUnchanged = "unchanged"
+)
+
+// MannWhitneyU returns U statistic of the target sample and two-sided p-value of the normal approximation
+// (with tie and continuity corrections)
+func MannWhitneyU(base []float64, target []float64) (float64, float64) {
+	type ranked struct {
+		value  float64
+		target bool
+	}
+	values := make([]ranked, 0, len(base)+len(target))
+	for _, value := range base {
+		values = append(values, ranked{value: value})
+	}
+	for _, value := range target {
+		values = append(values, ranked{value: value, target: true})
+	}
+	sort.Slice(values, func(i, j int) bool { return values[i].value < values[j].value })
+
+	n1, n2 := float64(len(target)), float64(len(base))
+	n := n1 + n2
+	rankSum, ties := 0.0, 0.0
+	for i := 0; i < len(values); {
+		j := i
+		for j < len(values) && values[j].value == values[i].value {
+			j++
+		}
+		rank := float64(i+j+1) / 2
+		for k := i; k < j; k++ {
+			if values[k].target {
+				rankSum += rank
+			}
+		}
+		t := float64(j - i)
+		ties += t*t*t - t
+		i = j
+	}
+	u := rankSum - n1*(n1+1)/2
+	if n1 == 0 || n2 == 0 {
+		return u, 1
+	}
+	mu := n1 * n2 / 2
+	sigma := math.Sqrt(n1 * n2 / 12 * ((n + 1) - ties/(n*(n-1))))
+	if sigma == 0 {
+		return u, 1
+	}
+	z := math.Max(math.Abs(u-mu)-0.5, 0) / sigma
+	return u, math.Erfc(z / math.Sqrt2)
+}
+
+type QueryComparison struct {
+	Runner       string  `json:"runner"`
+	Name         string  `json:"name"`
+	Measurement  string  `json:"measurement"`
+	BaseMedian   float64 `json:"base_median"`
+	TargetMedian float64 `json:"target_median"`
+	// Ratio is the relative change of the median time (target / base)
+	Ratio float64 `json:"ratio"`
+	// Effect is the rank-biserial correlation: 1 if every target sample is slower than every base sample, -1 if faster
+	Effect  float64 `json:"effect"`
+	PValue  float64 `json:"p_value"`
+	Verdict string  `json:"verdict"`
+}
+
+// CompareSamples classifies change as significant if Mann-Whitney U test rejects equality of distributions
+// at the alpha level and medians differ by more than threshold (relative)
+func CompareSamples(base []float64, target []float64, alpha float64, threshold float64) QueryComparison {
+	u, p := MannWhitneyU(base, target)
+	comparison := QueryComparison{
+		BaseMedian:   median(base),
+		TargetMedian: median(target),
+		PValue:       p,
+		Verdict:      VerdictUnchanged,
+	}
+	if len(base) > 0 && len(target) > 0 {
+		comparison.Effect = 2*u/float64(len(base)*len(target)) - 1
+	}
+	if comparison.BaseMedian > 0 {
+		comparison.Ratio = comparison.TargetMedian / comparison.BaseMedian
+	}
+	if p >= alpha || comparison.BaseMedian == 0 {
+		return comparison
+	}
+	if comparison.Ratio > 1+threshold {
+		comparison.Verdict = VerdictRegressed
+	} else if comparison.Ratio < 1-threshold {
+		comparison.Verdict = VerdictImproved
+	}
+	return comparison
+}
+
+// QueryMeasurements fetches samples of the query and falls back to total_time for queries without net_time
+func QueryMeasurements(storage *Storage, db *sql.DB, dataset string, name string, measurement string) (map[string][]float64, string, error) {
+	samples, err := storage.Measurements(db, dataset, name, measurement)
+	if err != nil {
+		return nil, "", err
+	}
+	if len(samples) == 0 && measurement == MeasurementNetTime {
+		samples, err = storage.Measurements(db, dataset, name, MeasurementTotalTime)
+		return samples, MeasurementTotalTime, err
+	}
+	return samples, measurement, nil
+}
+
+// CompareResults compares every query of the dataset measured by the same runner in both results dbs (see baseRunner)
+func CompareResults(storage *Storage, baseDb *sql.DB, targetDb *sql.DB, benchmark BenchmarkInfo, baseline BenchmarkInfo, runners []string, measurement string, alpha float64, threshold float64) ([]QueryComparison, error) {
+	queries, err := storage.WrittenQueries(targetDb, benchmark, benchmark.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, 0, len(queries))
+	for name := range queries {
+		if name != BuildName {
+			names = append(names, name)
+		}
+	}
+	slices.Sort(names)
+
+	comparisons := make([]QueryComparison, 0)
+	for _, name := range names {
+		target, kind, err := QueryMeasurements(storage, targetDb, benchmark.Dataset, name, measurement)
+		if err != nil {
+			return nil, err
+		}
+		base, err := storage.Measurements(baseDb, benchmark.Dataset, name, kind)
+		if err != nil {
+			return nil, err
+		}
+		for _, runner := range slices.Sorted(maps.Keys(target)) {
+			if len(runners) > 0 && !slices.Contains(runners, runner) {
+				continue
+			}
+			matched, ok := baseRunner(base, runner, benchmark, baseline)
+			if !ok {
+				Logger.Warnf("skip runner %v for query %v: no samples in the baseline %v", runner, name, baseline.Results)
+				continue
+			}
+			comparison := CompareSamples(base[matched], target[runner], alpha, threshold)
+			comparison.Runner = runner
+			comparison.Name = name
+			comparison.Measurement = kind
+			comparisons = append(comparisons, comparison)
+		}
+	}
+	return comparisons, nil
+}
+
+// baseRunner finds the runner of the baseline samples matching the target runner: compare labels (see InstanceTurso.Label)
+// of the target revision are stripped so labeled runner matches the runner of the plain baseline as well as the runner
+// labeled with the baseline revision; runners labeled with other revisions match only the runner with the same label
+func baseRunner(base map[string][]float64, runner string, benchmark BenchmarkInfo, baseline BenchmarkInfo) (string, bool) {
+	unlabeled := strings.TrimSuffix(runner, "-"+shortRevision(benchmark.Revision))
+	for _, candidate := range []string{runner, unlabeled, unlabeled + "-" + shortRevision(baseline.Revision)} {
+		if len(base[candidate]) > 0 {
+			return candidate, true
+		}
+	}
+	return "", false
+}
+
+// comparableHosts matches environment fingerprints (benchmarks recorded before fingerprints were introduced are matched by
+// hostname, arch and isolation)
+func comparableHosts(first map[string]string, second map[string]string) bool {
+	if first["fingerprint"] != "" && second["fingerprint"] != "" {
+		return first["fingerprint"] == second["fingerprint"]
+	}
+	for _, name := range isolationParameters {
+		if first[name] != second[name] {
+			return false
+		}
+	}
+	return first["hostname"] == second["hostname"] && first["arch"] == second["arch"]
+}
+
+// ErrBaselineNotFound is returned by FindComparableBaseline if branch has no benchmark of the comparable host
+var ErrBaselineNotFound = errors.New("baseline not found")
+
+// FindComparableBaseline returns latest finished benchmark of the branch executed on the comparable host
+func FindComparableBaseline(storage *Storage, meta *sql.DB, benchmark BenchmarkInfo, parameters map[string]string, branch string) (BenchmarkInfo, error) {
+	candidates, err := storage.BaselineCandidates(meta, benchmark, branch)
+	if err != nil {
+		return BenchmarkInfo{}, err
+	}
+	for _, candidate := range candidates {
+		db, err := storage.ConnectDb(candidate.Results)
+		if err != nil {
+			return BenchmarkInfo{}, err
+		}
+		candidateParameters, err := storage.Parameters(db)
+		db.Close()
+		if err != nil {
+			return BenchmarkInfo{}, err
+		}
+		if comparableHosts(parameters, candidateParameters) {
+			return candidate, nil
+		}
+	}
+	return BenchmarkInfo{}, fmt.Errorf("%w for %v in branch %v for host %v/%v (fingerprint %v)", ErrBaselineNotFound, benchmark, branch, parameters["hostname"], parameters["arch"], parameters["fingerprint"])
+}
+
+func WriteCompareReport(output io.Writer, comparisons []QueryComparison) error {
+	sorted := slices.Clone(comparisons)
+	sort.SliceStable(sorted, func(i, j int) bool { return sorted[i].Ratio > sorted[j].Ratio })
+	_, err := fmt.Fprintf(output, "%-10v %-10v %-10v %-8v %-8v %-8v %-20v %v\n", "verdict", "base", "target", "ratio", "effect", "p", "runner", "query")
+	if err != nil {
+		return err
+	}
+	counts := make(map[string]int)
+	for _, comparison := range sorted {
+		counts[comparison.Verdict]++
+		_, err := fmt.Fprintf(
+			output,
+			"%-10v %-10v %-10v %-8v %-8v %-8v %-20v %v\n",
+			comparison.Verdict,
+			fmt.Sprintf("%.4f", comparison.BaseMedian),
+			fmt.Sprintf("%.4f", comparison.TargetMedian),
+			fmt.Sprintf("%+.1f%%", 100*(comparison.Ratio-1)),
+			fmt.Sprintf("%+.2f", comparison.Effect),
+			fmt.Sprintf("%.3f", comparison.PValue),
+			comparison.Runner,
+			comparison.Name,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = fmt.Fprintf(output, "\n%v improved, %v regressed, %v unchanged\n", counts[VerdictImproved], counts[VerdictRegressed], counts[VerdictUnchanged])
+	return err
+}
+
+// ExitRegression is the exit code of the compare command which found regressions (other failures exit with 1),
+// so CI can distinguish regressed revision from the broken comparison
+const ExitRegression = 2
+
+// RegressionError is returned by the compare command if significant regressions are found
+type RegressionError struct {
+	Count    int
+	Revision string
+	Baseline string
+}
+
+func (e *RegressionError) Error() string {
+	return fmt.Sprintf("%v significant regressions found in %v compared to %v", e.Count, e.Revision, e.Baseline)
+}
+
+// CommandCompare compares finished benchmark of the revision against baseline and returns RegressionError
+// if significant regressions found
+func CommandCompare(storage *Storage, meta string, args []string) error {
+	flags := flag.NewFlagSet("compare", flag.ContinueOnError)
+	var (
+		revision         = flags.String("revision", "", "revision of the target benchmark")
+		baselineRevision = flags.String("baseline-revision", "", "revision of the baseline benchmark (latest finished benchmark of -branch on the same host if not set)")
+		branch           = flags.String("branch", "main", "baseline branch")
+		dataset          = flags.String("dataset", "", "dataset name")
+		runner           = flags.String("runner", "", "compare only results of the runner")
+		measurement      = flags.String("measurement", MeasurementNetTime, "measurement to compare (total_time is used for queries without net_time)")
+		alpha            = flags.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test")
+		threshold        = flags.Float64("threshold", 0.05, "minimal relative change of median time considered as a regression or improvement")
+		asJson           = flags.Bool("json", false, "print comparison as json")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *revision == "" || *dataset == "" {
+		return fmt.Errorf("revision and dataset must be set")
+	}
+	metaDb, err := storage.ConnectDb(meta)
+	if err != nil {
+		return err
+	}
+	defer metaDb.Close()
+
+	benchmark, err := storage.FindBenchmark(metaDb, *revision, *dataset)
+	if err != nil {
+		return err
+	}
+	targetDb, err := storage.ConnectDb(benchmark.Results)
+	if err != nil {
+		return err
+	}
+	defer targetDb.Close()
+	parameters, err := storage.Parameters(targetDb)
+	if err != nil {
+		return err
+	}
+
+	var baseline BenchmarkInfo
+	if *baselineRevision != "" {
+		baseline, err = storage.FindBenchmark(metaDb, *baselineRevision, *dataset)
+	} else {
+		baseline, err = FindComparableBaseline(storage, metaDb, benchmark, parameters, *branch)
+	}
+	if err != nil {
+		return err
+	}
+	baseDb, err := storage.ConnectDb(baseline.Results)
+	if err != nil {
+		return err
+	}
+	defer baseDb.Close()
+
+	runners := make([]string, 0)
+	if *runner != "" {
+		runners = append(runners, *runner)
+	}
+	comparisons, err := CompareResults(storage, baseDb, targetDb, benchmark, baseline, runners, *measurement, *alpha, *threshold)
+	if err != nil {
+		return err
+	}
+	if *asJson {
+		encoder := json.NewEncoder(os.Stdout)
+		encoder.SetIndent("", "  ")
+		err = encoder.Encode(map[string]any{
+			"dataset":  benchmark.Dataset,
+			"baseline": baseline.Revision,
+			"revision": benchmark.Revision,
+			"queries":  comparisons,
+		})
+	} else {
+		fmt.Printf("compare %v: %v (%v) -> %v (%v)\n\n", benchmark.Dataset, baseline.Revision, baseline.Results, benchmark.Revision, benchmark.Results)
+		err = WriteCompareReport(os.Stdout, comparisons)
+	}
+	if err != nil {
+		return err
+	}
+	regressed := 0
+	for _, comparison := range comparisons {
+		if comparison.Verdict == VerdictRegressed {
+			regressed++
+		}
+	}
+	if regressed > 0 {
+		return &RegressionError{Count: regressed, Revision: benchmark.Revision, Baseline: baseline.Revision}
+	}
+	return nil
+}
@@ -0,0 +1,60 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMannWhitneyU(t *testing.T) {
+	u, p := MannWhitneyU([]float64{1, 2, 3, 4, 5}, []float64{6, 7, 8, 9, 10})
+	require.Equal(t, 25.0, u)
+	require.InDelta(t, 0.012, p, 0.001)
+
+	u, p = MannWhitneyU([]float64{1, 2, 3}, []float64{1, 2, 3})
+	require.Equal(t, 4.5, u)
+	require.Equal(t, 1.0, p)
+
+	_, p = MannWhitneyU([]float64{1, 1, 1}, []float64{1, 1, 1})
+	require.Equal(t, 1.0, p)
+}
+
+func TestCompareSamples(t *testing.T) {
+	base := []float64{1.00, 1.01, 0.99, 1.02, 0.98}
+
+	regressed := CompareSamples(base, []float64{1.20, 1.21, 1.19, 1.22, 1.18}, 0.05, 0.05)
+	require.Equal(t, VerdictRegressed, regressed.Verdict)
+	require.InDelta(t, 1.2, regressed.Ratio, 1e-9)
+	require.Equal(t, 1.0, regressed.Effect)
+
+	improved := CompareSamples(base, []float64{0.80, 0.81, 0.79, 0.82, 0.78}, 0.05, 0.05)
+	require.Equal(t, VerdictImproved, improved.Verdict)
+	require.Equal(t, -1.0, improved.Effect)
+
+	// significant but below threshold
+	small := CompareSamples(base, []float64{1.03, 1.04, 1.05, 1.06, 1.035}, 0.05, 0.05)
+	require.Equal(t, VerdictUnchanged, small.Verdict)
+
+	// large but noisy
+	noisy := CompareSamples(base, []float64{0.5, 2.0, 0.9, 1.5, 1.3}, 0.05, 0.05)
+	require.Equal(t, VerdictUnchanged, noisy.Verdict)
+}
+
+func TestBaseRunner(t *testing.T) {
+	benchmark := BenchmarkInfo{Revision: "aaaaaaaaaaaa"}
+	baseline := BenchmarkInfo{Revision: "bbbbbbbbbbbb"}
+	samples := []float64{1}
+
+	runner, ok := baseRunner(map[string][]float64{"turso": samples}, "turso", benchmark, baseline)
+	require.True(t, ok)
+	require.Equal(t, "turso", runner)
+	runner, ok = baseRunner(map[string][]float64{"turso": samples}, "turso-aaaaaaaa", benchmark, baseline)
+	require.True(t, ok)
+	require.Equal(t, "turso", runner)
+	runner, ok = baseRunner(map[string][]float64{"turso-bbbbbbbb": samples}, "turso", benchmark, baseline)
+	require.True(t, ok)
+	require.Equal(t, "turso-bbbbbbbb", runner)
+	// runner built from the compare revision has no counterpart in the plain baseline
+	_, ok = baseRunner(map[string][]float64{"turso": samples}, "turso-cccccccc", benchmark, baseline)
+	require.False(t, ok)
+}
@@ -1,10 +1,17 @@
 package main
 
+import (
+	"strconv"
+	"strings"
+)
+
 type Query struct {
 	Name           string
 	Query          string
 	Runners        []string
 	MatchOnlyCount bool
+	// Cache is the cache mode the query is measured with (see CacheQueries)
+	Cache string
 }
 
 type Dataset interface {
@@ -21,3 +28,68 @@ type Instance interface {
 	Name() string
 	RunCmd(path string, query string) []string
 }
+
+// Normalizer can be implemented by the Instance which output format differs from the sqlite3 list mode
+type Normalizer interface {
+	Normalize(lines []string) []string
+}
+
+// NormalizeNumbers brings output of every runner to the same numeric formatting before comparison: integers are kept
+// as is and floats are rounded to 12 significant digits, so "2.0" and "2" or "0.30000000000000004" and "0.3" are equal
+// (engines differ in float formatting, decimal scale and precision of the aggregates)
+func NormalizeNumbers(lines []string) []string {
+	normalized := make([]string, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Split(line, "|")
+		for i, field := range fields {
+			if _, err := strconv.ParseInt(field, 10, 64); err == nil {
+				continue
+			}
+			if !strings.ContainsAny(field, "0123456789") {
+				continue
+			}
+			if value, err := strconv.ParseFloat(field, 64); err == nil {
+				fields[i] = strconv.FormatFloat(value, 'g', 12, 64)
+			}
+		}
+		normalized = append(normalized, strings.Join(fields, "|"))
+	}
+	return normalized
+}
+
+// Collector can be implemented by the Runner which keeps build artifacts in the size-limited cache;
+// artifacts of the given instances are in use by the running benchmark and must not be evicted
+type Collector interface {
+	Collect(instances []Instance) error
+}
+
+// Parametrized can be implemented by the Instance in order to record its configuration in the results parameters
+type Parametrized interface {
+	Parameters() (map[string]any, error)
+}
+
+// Engine can be implemented by the Instance which name differs from the engine name used in the Query.Runners
+type Engine interface {
+	Engine() string
+}
+
+func EngineName(instance Instance) string {
+	if engine, ok := instance.(Engine); ok {
+		return engine.Engine()
+	}
+	return instance.Name()
+}
+
+type BuildInfo struct {
+	// Log is the path to the file with build output
+	Log string
+	// Duration of the clean build in seconds (zero if the binary is taken from the build cache or clean builds are disabled)
+	Duration float64
+	// Size of the built binary in bytes
+	Size int64
+}
+
+// Built can be implemented by the Instance which is compiled from sources in order to record build artifacts
+type Built interface {
+	Build() BuildInfo
+}
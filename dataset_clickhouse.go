@@ -5,9 +5,9 @@ import (
 	"compress/gzip"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
+	"path/filepath"
 )
 
 var queriesClickhouse = []Query{
@@ -188,54 +188,63 @@ func (d *DatasetClickhouse) Load(path string) ([]Query, error) {
 		return queriesClickhouse, nil
 	}
 
-	url := "https://datasets.clickhouse.com/hits_compatible/hits.csv.gz"
-	response, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	body, err := gzip.NewReader(response.Body)
-	if err != nil {
-		return nil, err
-	}
-
 	tmp, err := os.CreateTemp("", "clickhouse-dataset-tmp")
 	if err != nil {
 		return nil, err
 	}
 	defer os.Remove(tmp.Name())
+	defer tmp.Close()
 
-	lines := bufio.NewScanner(body)
-	for i := 0; i < d.Rows && lines.Scan(); i++ {
-		chunk := lines.Bytes()
-		if err := write(tmp, chunk); err != nil {
-			return nil, err
+	url := "https://datasets.clickhouse.com/hits_compatible/hits.csv.gz"
+	err = DefaultDownloader.Fetch(url, func(response io.Reader) error {
+		if err := tmp.Truncate(0); err != nil {
+			return err
 		}
-		if err := write(tmp, []byte{'\n'}); err != nil {
-			return nil, err
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return err
 		}
-		for len(chunk) > 0 {
-			n, err := tmp.Write(chunk)
-			if err != nil {
-				return nil, err
+		body, err := gzip.NewReader(response)
+		if err != nil {
+			return err
+		}
+		lines := bufio.NewScanner(body)
+		lines.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+		for i := 0; i < d.Rows && lines.Scan(); i++ {
+			if err := write(tmp, lines.Bytes()); err != nil {
+				return err
 			}
-			chunk = chunk[n:]
+			if err := write(tmp, []byte{'\n'}); err != nil {
+				return err
+			}
+		}
+		if err := lines.Err(); err != nil {
+			return err
 		}
+		return tmp.Sync()
+	})
+	if err != nil {
+		return nil, err
 	}
-	err = tmp.Sync()
+
+	// database is initialized at the temporary path in order to not leave partially imported dataset on failure
+	db, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+"-tmp")
 	if err != nil {
 		return nil, err
 	}
+	db.Close()
+	defer os.Remove(db.Name())
 
-	if err := exec.Command("sqlite3", path, createSql).Run(); err != nil {
+	if err := exec.Command("sqlite3", db.Name(), createSql).Run(); err != nil {
 		return nil, fmt.Errorf("failed to init schema: %w", err)
 	}
 
 	Logger.Infof("ready to do sqlite: %v", fmt.Sprintf(".import --csv %v hits", tmp.Name()))
-	if err := exec.Command("sqlite3", path, fmt.Sprintf(".import --csv %v hits", tmp.Name())).Run(); err != nil {
+	if err := exec.Command("sqlite3", db.Name(), fmt.Sprintf(".import --csv %v hits", tmp.Name())).Run(); err != nil {
 		return nil, fmt.Errorf("failed to import db: %w", err)
 	}
 
+	if err := os.Rename(db.Name(), path); err != nil {
+		return nil, err
+	}
 	return queriesClickhouse, nil
 }
@@ -1,11 +1,5 @@
 package main
 
-import (
-	"io"
-	"net/http"
-	"os"
-)
-
 var queriesTpch = []Query{
 	{
 		Name: "1.sql",
@@ -754,22 +748,8 @@ type DatasetTpch struct{}
 
 func (d *DatasetTpch) Name() string { return "tpc-h" }
 func (d *DatasetTpch) Load(path string) ([]Query, error) {
-	if _, err := os.Stat(path); err == nil {
-		Logger.Infof("dataset %v already exists, skip initialization", d.Name())
-		return queriesTpch, nil
-	}
 	url := "https://github.com/lovasoa/TPCH-sqlite/releases/download/v1.0/TPC-H.db"
-	response, err := http.Get(url)
-	if err != nil {
-		return nil, err
-	}
-	defer response.Body.Close()
-
-	file, err := os.Create(path)
-	if err != nil {
-		return nil, err
-	}
-	_, err = io.Copy(file, response.Body)
+	err := DefaultDownloader.Download(url, path, ValidateSqlite)
 	if err != nil {
 		return nil, err
 	}
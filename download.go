@@ -0,0 +1,253 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"time"
+)
+
+type Downloader struct {
+	Client  *http.Client
+	Retries int
+	Backoff time.Duration
+	// StallTimeout aborts the attempt (which is retried then) if no response or body data is received for the duration;
+	// total download time is not limited as datasets are large (zero disables the check)
+	StallTimeout time.Duration
+	// Header is added to every request (optional)
+	Header http.Header
+}
+
+var DefaultDownloader = &Downloader{Client: &http.Client{}, Retries: 5, Backoff: time.Second, StallTimeout: time.Minute}
+
+// StallError reports attempt aborted because no data was received for the Timeout
+type StallError struct {
+	Url     string
+	Timeout time.Duration
+}
+
+func (e *StallError) Error() string {
+	return fmt.Sprintf("no data received from %v for %v", e.Url, e.Timeout)
+}
+
+// stallReader extends the deadline of the attempt on every read
+type stallReader struct {
+	reader  io.Reader
+	timer   *time.Timer
+	timeout time.Duration
+}
+
+func (r *stallReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		r.timer.Reset(r.timeout)
+	}
+	return n, err
+}
+
+type StatusError struct {
+	Url    string
+	Status int
+}
+
+func (e *StatusError) Error() string {
+	return fmt.Sprintf("unexpected status code %v for %v", e.Status, e.Url)
+}
+
+// NetworkError wraps failures of the request and of the response body reads (as opposed to the errors of the consumer)
+type NetworkError struct {
+	Url string
+	Err error
+}
+
+func (e *NetworkError) Error() string {
+	return fmt.Sprintf("failed to fetch %v: %v", e.Url, e.Err)
+}
+
+func (e *NetworkError) Unwrap() error { return e.Err }
+
+// networkReader wraps read errors of the response body into NetworkError
+type networkReader struct {
+	reader io.Reader
+	url    string
+}
+
+func (r *networkReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if err != nil && err != io.EOF {
+		err = &NetworkError{Url: r.url, Err: err}
+	}
+	return n, err
+}
+
+func retryable(err error) bool {
+	var status *StatusError
+	if errors.As(err, &status) {
+		return status.Status == http.StatusTooManyRequests || status.Status >= 500
+	}
+	var stall *StallError
+	var network *NetworkError
+	return errors.As(err, &stall) || errors.As(err, &network)
+}
+
+// Fetch calls consume with the body of the successful response and retries with exponential backoff
+// on network errors (including body read errors surfaced by consume), stalls and 5xx and 429 status codes;
+// other consume errors (e.g. validation of the downloaded content) are returned immediately
+func (d *Downloader) Fetch(url string, consume func(io.Reader) error) error {
+	var err error
+	backoff := d.Backoff
+	for attempt := 0; attempt <= d.Retries; attempt++ {
+		if attempt > 0 {
+			Logger.Warnf("fetch %v failed (attempt %v/%v), retry in %v: %v", url, attempt, d.Retries+1, backoff, err)
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		err = d.fetch(url, consume)
+		if err == nil || !retryable(err) {
+			return err
+		}
+	}
+	return err
+}
+
+func (d *Downloader) fetch(url string, consume func(io.Reader) error) error {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	if d.StallTimeout > 0 {
+		var stalled atomic.Bool
+		timer := time.AfterFunc(d.StallTimeout, func() {
+			stalled.Store(true)
+			cancel()
+		})
+		defer timer.Stop()
+		err := d.fetchBody(ctx, url, func(reader io.Reader) error {
+			return consume(&stallReader{reader: reader, timer: timer, timeout: d.StallTimeout})
+		})
+		if err != nil && stalled.Load() {
+			return &StallError{Url: url, Timeout: d.StallTimeout}
+		}
+		return err
+	}
+	return d.fetchBody(ctx, url, consume)
+}
+
+func (d *Downloader) fetchBody(ctx context.Context, url string, consume func(io.Reader) error) error {
+	request, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	for name, values := range d.Header {
+		request.Header[name] = values
+	}
+	response, err := d.Client.Do(request)
+	if err != nil {
+		return &NetworkError{Url: url, Err: err}
+	}
+	defer response.Body.Close()
+	if response.StatusCode != http.StatusOK {
+		return &StatusError{Url: url, Status: response.StatusCode}
+	}
+	return consume(&networkReader{reader: response.Body, url: url})
+}
+
+// Download saves url content to the filename (if it is not exists yet) through the temporary file
+// which is checked with validate (if set) and atomically renamed to the filename
+func (d *Downloader) Download(url string, filename string, validate func(string) error) error {
+	Logger.Infof("download %v to %v", url, filename)
+	if _, err := os.Stat(filename); err == nil {
+		Logger.Infof("file %v already exists", filename)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return d.Fetch(url, func(body io.Reader) error {
+		tmp, err := os.CreateTemp(filepath.Dir(filename), filepath.Base(filename)+"-tmp")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		_, err = io.Copy(tmp, body)
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		err = tmp.Sync()
+		if err != nil {
+			tmp.Close()
+			return err
+		}
+		err = tmp.Close()
+		if err != nil {
+			return err
+		}
+		if validate != nil {
+			err = validate(tmp.Name())
+			if err != nil {
+				return fmt.Errorf("downloaded file %v is invalid: %w", url, err)
+			}
+		}
+		return os.Rename(tmp.Name(), filename)
+	})
+}
+
+// ValidateZip reads all entries of the zip archive in order to verify their checksums
+func ValidateZip(filename string) error {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+	for _, file := range archive.File {
+		reader, err := file.Open()
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(io.Discard, reader)
+		reader.Close()
+		if err != nil {
+			return fmt.Errorf("corrupted entry %v: %w", file.Name, err)
+		}
+	}
+	return nil
+}
+
+// ValidateGzip reads the whole gzip stream in order to verify its checksum
+func ValidateGzip(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	reader, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(io.Discard, reader)
+	return err
+}
+
+// ValidateSqlite checks that file starts with the SQLite database header
+func ValidateSqlite(filename string) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	header := make([]byte, 16)
+	_, err = io.ReadFull(file, header)
+	if err != nil {
+		return err
+	}
+	if !bytes.Equal(header, []byte("SQLite format 3\x00")) {
+		return fmt.Errorf("file is not a sqlite database")
+	}
+	return nil
+}
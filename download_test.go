@@ -0,0 +1,113 @@
+package main
+
+import (
+	"archive/zip"
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func testZip(t *testing.T) []byte {
+	var buffer bytes.Buffer
+	archive := zip.NewWriter(&buffer)
+	file, err := archive.Create("turso-main/README.md")
+	require.Nil(t, err)
+	_, err = file.Write([]byte("turso"))
+	require.Nil(t, err)
+	require.Nil(t, archive.Close())
+	return buffer.Bytes()
+}
+
+func TestDownload(t *testing.T) {
+	content := testZip(t)
+	var requests atomic.Int32
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := requests.Add(1)
+		switch r.URL.Path {
+		case "/missing.zip":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("not found"))
+		case "/flaky.zip":
+			if n%3 != 0 {
+				w.WriteHeader(http.StatusBadGateway)
+				return
+			}
+			w.Write(content)
+		case "/stalled.zip":
+			if n == 1 {
+				w.Write(content[:len(content)/2])
+				w.(http.Flusher).Flush()
+				<-r.Context().Done()
+				return
+			}
+			w.Write(content)
+		case "/truncated.zip":
+			w.Write(content[:len(content)/2])
+		default:
+			w.Write(content)
+		}
+	}))
+	defer server.Close()
+
+	dir := t.TempDir()
+	downloader := &Downloader{Client: server.Client(), Retries: 3, Backoff: time.Millisecond, StallTimeout: 100 * time.Millisecond}
+
+	t.Run("not found", func(t *testing.T) {
+		requests.Store(0)
+		err := downloader.Download(server.URL+"/missing.zip", path.Join(dir, "missing.zip"), ValidateZip)
+		require.ErrorContains(t, err, "404")
+		require.Equal(t, int32(1), requests.Load())
+		_, err = os.Stat(path.Join(dir, "missing.zip"))
+		require.True(t, os.IsNotExist(err))
+	})
+
+	t.Run("retry", func(t *testing.T) {
+		requests.Store(0)
+		require.Nil(t, downloader.Download(server.URL+"/flaky.zip", path.Join(dir, "flaky.zip"), ValidateZip))
+		require.Equal(t, int32(3), requests.Load())
+		data, err := os.ReadFile(path.Join(dir, "flaky.zip"))
+		require.Nil(t, err)
+		require.Equal(t, content, data)
+	})
+
+	t.Run("stalled", func(t *testing.T) {
+		requests.Store(0)
+		require.Nil(t, downloader.Download(server.URL+"/stalled.zip", path.Join(dir, "stalled.zip"), ValidateZip))
+		require.Equal(t, int32(2), requests.Load())
+
+		var stall *StallError
+		noRetries := &Downloader{Client: server.Client(), StallTimeout: 100 * time.Millisecond}
+		requests.Store(0)
+		require.ErrorAs(t, noRetries.Fetch(server.URL+"/stalled.zip", func(body io.Reader) error {
+			_, err := io.Copy(io.Discard, body)
+			return err
+		}), &stall)
+	})
+
+	t.Run("invalid", func(t *testing.T) {
+		requests.Store(0)
+		err := downloader.Download(server.URL+"/truncated.zip", path.Join(dir, "truncated.zip"), ValidateZip)
+		require.NotNil(t, err)
+		// validation errors are not retried
+		require.Equal(t, int32(1), requests.Load())
+		entries, err := os.ReadDir(dir)
+		require.Nil(t, err)
+		for _, entry := range entries {
+			require.NotContains(t, entry.Name(), "truncated")
+		}
+	})
+
+	t.Run("exists", func(t *testing.T) {
+		requests.Store(0)
+		require.Nil(t, downloader.Download(server.URL+"/flaky.zip", path.Join(dir, "flaky.zip"), ValidateZip))
+		require.Equal(t, int32(0), requests.Load())
+	})
+}
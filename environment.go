@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime/debug"
+	"slices"
+	"strconv"
+	"strings"
+)
+
+// fingerprintParameters are the env.* parameters which define the host class: results of the hosts with the same
+// fingerprint are comparable (hostname, toolchain and harness versions are recorded but intentionally excluded).
+// Change of any of them (including routine kernel and microcode updates) breaks comparability for compare and
+// profiling baselines; history is kept per host (see HistoryHost) and such changes are marked in change points
+var fingerprintParameters = []string{
+	"env.arch",
+	"env.platform",
+	"env.kernel",
+	"env.cpu_count",
+	"env.cpu_model",
+	"env.microcode",
+	"env.governor",
+	"env.turbo",
+	"env.smt",
+	"env.ram",
+	"env.fs_type",
+	"env.mount_options",
+	"env.storage_model",
+}
+
+// isolationParameters change measured times as well: they are part of the fingerprint only if set,
+// so fingerprints of the hosts without isolation are the same as before isolation was introduced
+var isolationParameters = []string{"isolation.cpus", "isolation.memory_max", "isolation.cpu_max"}
+
+// EnvironmentFingerprint returns stable hash of the host class and isolation parameters
+func EnvironmentFingerprint(environment map[string]string) string {
+	fields := make([]string, 0, len(fingerprintParameters)+len(isolationParameters))
+	for _, name := range fingerprintParameters {
+		fields = append(fields, fmt.Sprintf("%v=%v", name, environment[name]))
+	}
+	for _, name := range isolationParameters {
+		if environment[name] != "" {
+			fields = append(fields, fmt.Sprintf("%v=%v", name, environment[name]))
+		}
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(hash[:8])
+}
+
+type MountInfo struct {
+	Point   string
+	Source  string
+	FsType  string
+	Options string
+}
+
+func unescapeMount(value string) string {
+	var builder strings.Builder
+	for i := 0; i < len(value); i++ {
+		if value[i] == '\\' && i+3 < len(value) {
+			if code, err := strconv.ParseUint(value[i+1:i+4], 8, 8); err == nil {
+				builder.WriteByte(byte(code))
+				i += 3
+				continue
+			}
+		}
+		builder.WriteByte(value[i])
+	}
+	return builder.String()
+}
+
+// ParseMountInfo finds mount (in /proc/self/mountinfo format) with the longest mount point containing the path
+func ParseMountInfo(reader io.Reader, path string) (MountInfo, error) {
+	var found MountInfo
+	scanner := bufio.NewScanner(reader)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		separator := slices.Index(fields, "-")
+		if separator < 6 || separator+2 >= len(fields) {
+			continue
+		}
+		point := unescapeMount(fields[4])
+		relative, err := filepath.Rel(point, path)
+		if err != nil || !filepath.IsLocal(relative) {
+			continue
+		}
+		if len(point) >= len(found.Point) {
+			found = MountInfo{
+				Point:   point,
+				Source:  unescapeMount(fields[separator+2]),
+				FsType:  fields[separator+1],
+				Options: fields[5],
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return MountInfo{}, err
+	}
+	if found.Point == "" {
+		return MountInfo{}, fmt.Errorf("mount point for %v not found", path)
+	}
+	return found, nil
+}
+
+func mountOf(dir string) (MountInfo, error) {
+	absolute, err := filepath.Abs(dir)
+	if err != nil {
+		return MountInfo{}, err
+	}
+	file, err := os.Open("/proc/self/mountinfo")
+	if err != nil {
+		return MountInfo{}, err
+	}
+	defer file.Close()
+	return ParseMountInfo(file, absolute)
+}
+
+// storageModel resolves model of the block device (for partitions model of the parent device is used)
+func storageModel(source string) (string, error) {
+	if !strings.HasPrefix(source, "/dev/") {
+		return "", fmt.Errorf("%v is not a block device", source)
+	}
+	device, err := filepath.EvalSymlinks(source)
+	if err != nil {
+		return "", err
+	}
+	block, err := filepath.EvalSymlinks(filepath.Join("/sys/class/block", filepath.Base(device)))
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(filepath.Join(block, "partition")); err == nil {
+		block = filepath.Dir(block)
+	}
+	return readTrimmed(filepath.Join(block, "device", "model"))
+}
+
+func readTrimmed(path string) (string, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(data)), nil
+}
+
+func commandVersion(name string, args ...string) (string, error) {
+	output, err := exec.Command(name, args...).Output()
+	if err != nil {
+		return "", fmt.Errorf("%v %v failed: %w", name, strings.Join(args, " "), err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// turboState reports whether frequency boost is enabled (intel_pstate and acpi-cpufreq interfaces are supported)
+func turboState() (string, error) {
+	if value, err := readTrimmed("/sys/devices/system/cpu/intel_pstate/no_turbo"); err == nil {
+		return map[string]string{"0": "on", "1": "off"}[value], nil
+	}
+	if value, err := readTrimmed("/sys/devices/system/cpu/cpufreq/boost"); err == nil {
+		return map[string]string{"1": "on", "0": "off"}[value], nil
+	}
+	return "", fmt.Errorf("cpu boost control not found")
+}
+
+func harnessVersion() (string, string) {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return "", ""
+	}
+	settings := make(map[string]string)
+	for _, setting := range info.Settings {
+		settings[setting.Key] = setting.Value
+	}
+	commit := settings["vcs.revision"]
+	if commit != "" && settings["vcs.modified"] == "true" {
+		commit += "-dirty"
+	}
+	return info.Main.Version, commit
+}
+
+// CaptureEnvironment records host, filesystem and toolchain configuration as env.* parameters;
+// probes which are not available on the host are skipped and their errors are joined
+func CaptureEnvironment(info SysInfo, dir string) (map[string]string, error) {
+	environment := map[string]string{
+		"env.arch":      info.Arch,
+		"env.hostname":  info.Hostname,
+		"env.platform":  info.Platform,
+		"env.kernel":    info.Kernel,
+		"env.cpu_count": strconv.Itoa(info.CPUCount),
+		"env.cpu_model": info.CPUModel,
+		"env.microcode": info.Microcode,
+		"env.ram":       fmt.Sprintf("%.0f", info.RAM),
+	}
+	var errs []error
+	probe := func(name string, value string, err error) {
+		if err != nil {
+			errs = append(errs, fmt.Errorf("%v: %w", name, err))
+			return
+		}
+		environment[name] = value
+	}
+
+	governor, err := readTrimmed("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor")
+	probe("env.governor", governor, err)
+	turbo, err := turboState()
+	probe("env.turbo", turbo, err)
+	smt, err := readTrimmed("/sys/devices/system/cpu/smt/control")
+	probe("env.smt", smt, err)
+
+	mount, err := mountOf(dir)
+	probe("env.fs_type", mount.FsType, err)
+	if err == nil {
+		environment["env.mount_options"] = mount.Options
+		model, err := storageModel(mount.Source)
+		probe("env.storage_model", model, err)
+	}
+
+	rustc, err := commandVersion("rustc", "--version")
+	probe("env.rustc", rustc, err)
+	cargo, err := commandVersion("cargo", "--version")
+	probe("env.cargo", cargo, err)
+	sqlite, err := commandVersion("sqlite3", "--version")
+	probe("env.sqlite3", sqlite, err)
+
+	version, commit := harnessVersion()
+	environment["env.harness_version"] = version
+	environment["env.harness_commit"] = commit
+	return environment, errors.Join(errs...)
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseMountInfo(t *testing.T) {
+	mountinfo := strings.Join([]string{
+		"22 1 259:2 / / rw,relatime shared:1 - ext4 /dev/nvme0n1p2 rw,errors=remount-ro",
+		"23 22 0:21 / /proc rw,nosuid,nodev,noexec,relatime shared:2 - proc proc rw",
+		"45 22 259:3 / /mnt/bench\\040data rw,noatime shared:30 - xfs /dev/nvme1n1 rw,attr2,inode64",
+		"46 22 259:4 / /mnt/bench rw,relatime - ext4 /dev/sda1 rw",
+	}, "\n")
+
+	mount, err := ParseMountInfo(strings.NewReader(mountinfo), "/mnt/bench data/runner")
+	require.Nil(t, err)
+	require.Equal(t, MountInfo{Point: "/mnt/bench data", Source: "/dev/nvme1n1", FsType: "xfs", Options: "rw,noatime"}, mount)
+
+	mount, err = ParseMountInfo(strings.NewReader(mountinfo), "/mnt/bench/runner")
+	require.Nil(t, err)
+	require.Equal(t, "/dev/sda1", mount.Source)
+
+	mount, err = ParseMountInfo(strings.NewReader(mountinfo), "/home/runner")
+	require.Nil(t, err)
+	require.Equal(t, MountInfo{Point: "/", Source: "/dev/nvme0n1p2", FsType: "ext4", Options: "rw,relatime"}, mount)
+
+	_, err = ParseMountInfo(strings.NewReader(""), "/home/runner")
+	require.NotNil(t, err)
+}
+
+func TestEnvironmentFingerprint(t *testing.T) {
+	environment := map[string]string{"env.arch": "amd64", "env.cpu_model": "AMD EPYC 9454P", "env.governor": "performance", "env.hostname": "a"}
+	fingerprint := EnvironmentFingerprint(environment)
+	require.Len(t, fingerprint, 16)
+
+	environment["env.hostname"] = "b"
+	environment["env.rustc"] = "rustc 1.90.0"
+	require.Equal(t, fingerprint, EnvironmentFingerprint(environment))
+
+	environment["env.governor"] = "powersave"
+	require.NotEqual(t, fingerprint, EnvironmentFingerprint(environment))
+}
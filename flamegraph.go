@@ -0,0 +1,360 @@
+package main
+
+import (
+	"bufio"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"html"
+	"io"
+	"os"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+type FoldedStack struct {
+	Frames []string
+	Count  int
+}
+
+// ParseFolded reads collapsed stacks in the format root;...;leaf count
+func ParseFolded(input io.Reader) ([]FoldedStack, error) {
+	stacks := make([]FoldedStack, 0)
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		i := strings.LastIndexByte(line, ' ')
+		if i < 0 {
+			return nil, fmt.Errorf("invalid folded line: %v", line)
+		}
+		count, err := strconv.Atoi(line[i+1:])
+		if err != nil {
+			return nil, fmt.Errorf("invalid folded line: %v", line)
+		}
+		stacks = append(stacks, FoldedStack{Frames: strings.Split(line[:i], ";"), Count: count})
+	}
+	return stacks, scanner.Err()
+}
+
+func WriteFolded(output io.Writer, stacks []FoldedStack) error {
+	for _, stack := range stacks {
+		if _, err := fmt.Fprintf(output, "%v %v\n", strings.Join(stack.Frames, ";"), stack.Count); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type samplyProfile struct {
+	Libs []struct {
+		DebugName string `json:"debugName"`
+		DebugId   string `json:"debugId"`
+	} `json:"libs"`
+	Shared struct {
+		StringArray []string `json:"stringArray"`
+	} `json:"shared"`
+	Threads []struct {
+		Name        string   `json:"name"`
+		StringArray []string `json:"stringArray"`
+		Samples     struct {
+			Stack  []*int     `json:"stack"`
+			Weight []*float64 `json:"weight"`
+		} `json:"samples"`
+		StackTable struct {
+			Frame  []int  `json:"frame"`
+			Prefix []*int `json:"prefix"`
+		} `json:"stackTable"`
+		FrameTable struct {
+			Address []int `json:"address"`
+			Func    []int `json:"func"`
+		} `json:"frameTable"`
+		FuncTable struct {
+			Name     []int `json:"name"`
+			Resource []int `json:"resource"`
+		} `json:"funcTable"`
+		ResourceTable struct {
+			Lib []*int `json:"lib"`
+		} `json:"resourceTable"`
+	} `json:"threads"`
+}
+
+type samplySymbols struct {
+	StringTable []string `json:"string_table"`
+	Data        []struct {
+		DebugName   string `json:"debug_name"`
+		DebugId     string `json:"debug_id"`
+		SymbolTable []struct {
+			Rva    int `json:"rva"`
+			Size   int `json:"size"`
+			Symbol int `json:"symbol"`
+		} `json:"symbol_table"`
+	} `json:"data"`
+}
+
+func readJson(filename string, target any) error {
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	var reader io.Reader = file
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(file)
+		if err != nil {
+			return err
+		}
+		defer gz.Close()
+		reader = gz
+	}
+	return json.NewDecoder(reader).Decode(target)
+}
+
+// FoldSamplyProfile converts samply (Firefox profiler processed format) profile to collapsed stacks;
+// functions are symbolicated with the presymbolicated sidecar file if it is available
+func FoldSamplyProfile(profileFile string, symsFile string) ([]FoldedStack, error) {
+	var profile samplyProfile
+	if err := readJson(profileFile, &profile); err != nil {
+		return nil, err
+	}
+	var symbols samplySymbols
+	if symsFile != "" {
+		if err := readJson(symsFile, &symbols); err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+	resolve := func(lib int, address int) (string, bool) {
+		if lib < 0 || lib >= len(profile.Libs) || address < 0 {
+			return "", false
+		}
+		for _, data := range symbols.Data {
+			if data.DebugId != profile.Libs[lib].DebugId || data.DebugName != profile.Libs[lib].DebugName {
+				continue
+			}
+			i := sort.Search(len(data.SymbolTable), func(i int) bool { return data.SymbolTable[i].Rva > address }) - 1
+			if i >= 0 && address < data.SymbolTable[i].Rva+max(data.SymbolTable[i].Size, 1) {
+				if symbol := data.SymbolTable[i].Symbol; symbol >= 0 && symbol < len(symbols.StringTable) {
+					return symbols.StringTable[symbol], true
+				}
+			}
+		}
+		return "", false
+	}
+
+	counts := make(map[string]int, 0)
+	order := make([]string, 0)
+	for _, thread := range profile.Threads {
+		names := thread.StringArray
+		if len(names) == 0 {
+			names = profile.Shared.StringArray
+		}
+		frameName := func(frame int) (string, error) {
+			if frame < 0 || frame >= len(thread.FrameTable.Func) || frame >= len(thread.FrameTable.Address) {
+				return "", fmt.Errorf("frame %v is out of frame table of thread %v", frame, thread.Name)
+			}
+			function := thread.FrameTable.Func[frame]
+			if function < 0 || function >= len(thread.FuncTable.Resource) || function >= len(thread.FuncTable.Name) {
+				return "", fmt.Errorf("function %v is out of func table of thread %v", function, thread.Name)
+			}
+			if resource := thread.FuncTable.Resource[function]; resource >= 0 && resource < len(thread.ResourceTable.Lib) && thread.ResourceTable.Lib[resource] != nil {
+				if name, ok := resolve(*thread.ResourceTable.Lib[resource], thread.FrameTable.Address[frame]); ok {
+					return name, nil
+				}
+			}
+			if name := thread.FuncTable.Name[function]; name >= 0 && name < len(names) {
+				return names[name], nil
+			}
+			return "[unknown]", nil
+		}
+		for i, stack := range thread.Samples.Stack {
+			if stack == nil {
+				continue
+			}
+			weight := 1
+			if i < len(thread.Samples.Weight) && thread.Samples.Weight[i] != nil {
+				weight = int(*thread.Samples.Weight[i])
+			}
+			frames := make([]string, 0)
+			for current := stack; current != nil; current = thread.StackTable.Prefix[*current] {
+				if *current < 0 || *current >= len(thread.StackTable.Frame) || *current >= len(thread.StackTable.Prefix) {
+					return nil, fmt.Errorf("stack %v is out of stack table of thread %v", *current, thread.Name)
+				}
+				// prefixes of the valid profile always point to the earlier stacks, so the longer chain is a cycle
+				if len(frames) > len(thread.StackTable.Frame) {
+					return nil, fmt.Errorf("stack %v of thread %v has cyclic prefixes", *stack, thread.Name)
+				}
+				name, err := frameName(thread.StackTable.Frame[*current])
+				if err != nil {
+					return nil, err
+				}
+				frames = append(frames, replaceSemicolons(name))
+			}
+			frames = append(frames, replaceSemicolons(thread.Name))
+			slices.Reverse(frames)
+			key := strings.Join(frames, ";")
+			if _, ok := counts[key]; !ok {
+				order = append(order, key)
+			}
+			counts[key] += weight
+		}
+	}
+	stacks := make([]FoldedStack, 0, len(order))
+	for _, key := range order {
+		stacks = append(stacks, FoldedStack{Frames: strings.Split(key, ";"), Count: counts[key]})
+	}
+	return stacks, nil
+}
+
+func replaceSemicolons(name string) string { return strings.ReplaceAll(name, ";", ":") }
+
+type FlameNode struct {
+	Name     string
+	Value    int
+	Children []*FlameNode
+	// Delta is used by differential flamegraph and holds difference of the node value between two profiles
+	Delta int
+}
+
+func (n *FlameNode) child(name string) *FlameNode {
+	for _, child := range n.Children {
+		if child.Name == name {
+			return child
+		}
+	}
+	child := &FlameNode{Name: name}
+	n.Children = append(n.Children, child)
+	return child
+}
+
+func BuildFlameTree(stacks []FoldedStack) *FlameNode {
+	root := &FlameNode{Name: "all"}
+	for _, stack := range stacks {
+		root.Value += stack.Count
+		node := root
+		for _, frame := range stack.Frames {
+			node = node.child(frame)
+			node.Value += stack.Count
+		}
+	}
+	return root
+}
+
+func (n *FlameNode) depth() int {
+	depth := 0
+	for _, child := range n.Children {
+		depth = max(depth, child.depth())
+	}
+	return depth + 1
+}
+
+func HashColor(node *FlameNode) string {
+	hash := fnv.New32a()
+	hash.Write([]byte(node.Name))
+	value := hash.Sum32()
+	return fmt.Sprintf("rgb(%v,%v,%v)", 205+value%50, 80+(value>>8)%130, 40+(value>>16)%40)
+}
+
+const (
+	flameWidth       = 1200.0
+	flameFrameHeight = 16.0
+	flameHeader      = 32.0
+)
+
+// RenderFlamegraph writes self-contained SVG flamegraph (root at the bottom) with tooltips for every frame
+func RenderFlamegraph(output io.Writer, title string, root *FlameNode, color func(*FlameNode) string) error {
+	height := flameHeader + float64(root.depth())*flameFrameHeight + 8
+	w := bufio.NewWriter(output)
+	fmt.Fprintf(w, `<?xml version="1.0" standalone="no"?>`+"\n")
+	fmt.Fprintf(w, `<svg version="1.1" width="%v" height="%v" viewBox="0 0 %v %v" xmlns="http://www.w3.org/2000/svg">`+"\n", flameWidth, height, flameWidth, height)
+	fmt.Fprintf(w, `<rect x="0" y="0" width="100%%" height="100%%" fill="#f8f8f8"/>`+"\n")
+	fmt.Fprintf(w, `<text x="%v" y="20" font-family="Verdana" font-size="15" text-anchor="middle">%v</text>`+"\n", flameWidth/2, html.EscapeString(title))
+	if root.Value > 0 {
+		renderFlameNode(w, root, root.Value, 0, 0, height, color)
+	}
+	fmt.Fprintf(w, "</svg>\n")
+	return w.Flush()
+}
+
+func renderFlameNode(w io.Writer, node *FlameNode, total int, offset int, depth int, height float64, color func(*FlameNode) string) {
+	x := float64(offset) / float64(total) * flameWidth
+	width := float64(node.Value) / float64(total) * flameWidth
+	if width < 0.1 {
+		return
+	}
+	y := height - float64(depth+1)*flameFrameHeight - 4
+	tooltip := fmt.Sprintf("%v (%v samples, %.2f%%)", node.Name, node.Value, 100*float64(node.Value)/float64(total))
+	if node.Delta != 0 {
+		tooltip = fmt.Sprintf("%v (%v samples, %.2f%%, delta %+d)", node.Name, node.Value, 100*float64(node.Value)/float64(total), node.Delta)
+	}
+	fmt.Fprintf(w, `<g><title>%v</title><rect x="%.1f" y="%.1f" width="%.1f" height="%.1f" fill="%v" rx="2" ry="2"/>`, html.EscapeString(tooltip), x, y, width, flameFrameHeight-1, color(node))
+	if chars := int(width / 7); chars >= 3 {
+		label := []rune(node.Name)
+		if len(label) > chars {
+			label = append(label[:chars-2], '.', '.')
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f" font-family="Verdana" font-size="11">%v</text>`, x+3, y+flameFrameHeight-4, html.EscapeString(string(label)))
+	}
+	fmt.Fprintf(w, "</g>\n")
+
+	children := slices.Clone(node.Children)
+	slices.SortFunc(children, func(a, b *FlameNode) int { return strings.Compare(a.Name, b.Name) })
+	for _, child := range children {
+		renderFlameNode(w, child, total, offset, depth+1, height, color)
+		offset += child.Value
+	}
+}
+
+// RenderProfile produces folded stacks (unless profiler already wrote them) and flamegraph SVG from the raw profile files
+func RenderProfile(files []string, prefix string, title string) ([]string, error) {
+	var stacks []FoldedStack
+	var err error
+	produced := make([]string, 0)
+	folded := fmt.Sprintf("%v.folded", prefix)
+	switch {
+	case slices.Contains(files, folded):
+		file, err := os.Open(folded)
+		if err != nil {
+			return nil, err
+		}
+		stacks, err = ParseFolded(file)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+	case slices.Contains(files, fmt.Sprintf("%v.json.gz", prefix)):
+		stacks, err = FoldSamplyProfile(fmt.Sprintf("%v.json.gz", prefix), fmt.Sprintf("%v.json.syms.json", prefix))
+		if err != nil {
+			return nil, err
+		}
+		file, err := os.Create(folded)
+		if err != nil {
+			return nil, err
+		}
+		err = WriteFolded(file, stacks)
+		file.Close()
+		if err != nil {
+			return nil, err
+		}
+		produced = append(produced, folded)
+	default:
+		return nil, nil
+	}
+
+	svg := fmt.Sprintf("%v.svg", prefix)
+	file, err := os.Create(svg)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+	err = RenderFlamegraph(file, title, BuildFlameTree(stacks), HashColor)
+	if err != nil {
+		return nil, err
+	}
+	return append(produced, svg), nil
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/require"
+)
+
+const testSamplyProfile = `{
+	"libs": [{"debugName": "tursodb", "debugId": "ABC"}],
+	"shared": {"stringArray": ["0x10", "0x20", "0x30"]},
+	"threads": [{
+		"name": "tursodb",
+		"samples": {"stack": [1, 2, 1, null], "weight": null},
+		"stackTable": {"frame": [0, 1, 2], "prefix": [null, 0, 0]},
+		"frameTable": {"address": [16, 32, 48], "func": [0, 1, 2]},
+		"funcTable": {"name": [0, 1, 2], "resource": [0, 0, -1]},
+		"resourceTable": {"lib": [0]}
+	}]
+}`
+
+const testSamplySymbols = `{
+	"string_table": ["main", "turso_core::vdbe::step"],
+	"data": [{"debug_name": "tursodb", "debug_id": "ABC", "symbol_table": [{"rva": 16, "size": 8, "symbol": 0}, {"rva": 32, "size": 8, "symbol": 1}]}]
+}`
+
+func TestFoldSamplyProfile(t *testing.T) {
+	dir := t.TempDir()
+	prefix := path.Join(dir, "profile")
+
+	var compressed bytes.Buffer
+	gz := gzip.NewWriter(&compressed)
+	_, err := gz.Write([]byte(testSamplyProfile))
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	require.Nil(t, os.WriteFile(prefix+".json.gz", compressed.Bytes(), 0o644))
+	require.Nil(t, os.WriteFile(prefix+".json.syms.json", []byte(testSamplySymbols), 0o644))
+
+	stacks, err := FoldSamplyProfile(prefix+".json.gz", prefix+".json.syms.json")
+	require.Nil(t, err)
+	require.Equal(t, []FoldedStack{
+		{Frames: []string{"tursodb", "main", "turso_core::vdbe::step"}, Count: 2},
+		{Frames: []string{"tursodb", "main", "0x30"}, Count: 1},
+	}, stacks)
+
+	files, err := RenderProfile([]string{prefix + ".json.gz", prefix + ".json.syms.json"}, prefix, "turso tpc-h/1.sql")
+	require.Nil(t, err)
+	require.Equal(t, []string{prefix + ".folded", prefix + ".svg"}, files)
+
+	folded, err := os.Open(prefix + ".folded")
+	require.Nil(t, err)
+	defer folded.Close()
+	parsed, err := ParseFolded(folded)
+	require.Nil(t, err)
+	require.Equal(t, stacks, parsed)
+
+	svg, err := os.ReadFile(prefix + ".svg")
+	require.Nil(t, err)
+	require.True(t, strings.HasPrefix(string(svg), "<?xml"))
+	require.Contains(t, string(svg), "turso_core::vdbe::step (2 samples, 66.67%)")
+	require.Contains(t, string(svg), "turso tpc-h/1.sql")
+}
+
+func TestFoldSamplyProfileMalformed(t *testing.T) {
+	dir := t.TempDir()
+	for name, tables := range map[string]string{
+		"stack":    `"stackTable": {"frame": [0], "prefix": [null]}, "frameTable": {"address": [16], "func": [0]}, "funcTable": {"name": [0], "resource": [-1]}`,
+		"frame":    `"stackTable": {"frame": [0, 5], "prefix": [null, 0]}, "frameTable": {"address": [16], "func": [0]}, "funcTable": {"name": [0], "resource": [-1]}`,
+		"function": `"stackTable": {"frame": [0, 0], "prefix": [null, 0]}, "frameTable": {"address": [16], "func": [3]}, "funcTable": {"name": [0], "resource": [-1]}`,
+		"cycle":    `"stackTable": {"frame": [0, 0], "prefix": [1, 0]}, "frameTable": {"address": [16], "func": [0]}, "funcTable": {"name": [0], "resource": [-1]}`,
+	} {
+		profile := path.Join(dir, name+".json")
+		content := `{"shared": {"stringArray": ["main"]}, "threads": [{"name": "tursodb", "samples": {"stack": [1]}, ` + tables + `, "resourceTable": {"lib": []}}]}`
+		require.Nil(t, os.WriteFile(profile, []byte(content), 0o644))
+		_, err := FoldSamplyProfile(profile, "")
+		require.NotNil(t, err, name)
+	}
+}
+
+func TestRenderFlamegraphTruncatesRunes(t *testing.T) {
+	root := &FlameNode{Name: "all", Value: 1, Children: []*FlameNode{{Name: strings.Repeat("ф", 1000), Value: 1}}}
+	var output bytes.Buffer
+	require.Nil(t, RenderFlamegraph(&output, "title", root, func(*FlameNode) string { return "red" }))
+	require.True(t, utf8.Valid(output.Bytes()))
+	require.Contains(t, output.String(), "фф..</text>")
+}
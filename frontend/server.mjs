@@ -3,6 +3,7 @@ import { spawn } from "child_process";
 import httpProxy from "http-proxy";
 import { mkdtempSync, rm, writeFileSync } from "fs";
 import { join, normalize } from "path";
+import { gzipSync, zstdDecompressSync } from "zlib";
 import { cwd, loadEnvFile } from "process";
 import { createServer } from "net";
 import { createReadStream, stat } from "fs";
@@ -67,6 +68,32 @@ function url(name) {
   return `libsql://${name}-biblink-spkeu7.aws-eu-west-1.turso.io`;
 }
 
+// profiles are stored compressed with zstd and split into chunks; legacy profiles table is used as a fallback
+async function loadProfiles(db, runner, dataset, name) {
+  let files = [];
+  try {
+    files = await db.prepare("SELECT filename, hash, encoding FROM profile_files WHERE runner = ? AND dataset = ? AND name = ?").all([runner, dataset, name]);
+  } catch (e) {
+    console.info('chunked profiles are not available', e);
+  }
+  if (files.length == 0) {
+    return await db.prepare("SELECT filename, content FROM profiles WHERE runner = ? AND dataset = ? AND name = ?").all([runner, dataset, name]);
+  }
+  const profiles = [];
+  for (const file of files) {
+    const chunks = await db.prepare("SELECT content FROM profile_chunks WHERE hash = ? ORDER BY chunk").all([file.hash]);
+    const compressed = Buffer.concat(chunks.map(x => Buffer.from(x.content)));
+    let content = zstdDecompressSync(compressed);
+    if (file.encoding == 'gzip+zstd') {
+      content = gzipSync(content);
+    } else if (file.encoding != 'zstd') {
+      throw new Error(`unknown profile encoding: ${file.encoding}`);
+    }
+    profiles.push({ filename: file.filename, content: content });
+  }
+  return profiles;
+}
+
 const server = http.createServer(async (req, res) => {
   if (!req.url.startsWith("/profile/")) {
     return serveStatic(req, res);
@@ -85,11 +112,7 @@ const server = http.createServer(async (req, res) => {
     const db = connect({ url: url(name), authToken: process.env.TURSO_DB_AUTH_TOKEN });
     let profiles;
     try {
-      profiles = await db.prepare("SELECT filename, content FROM profiles WHERE runner = ? AND dataset = ? AND name = ?").all([
-        components[3],
-        components[4],
-        components[5],
-      ]);
+      profiles = await loadProfiles(db, components[3], components[4], components[5]);
     } catch (e) {
       console.error('wtf', e);
       throw e;
@@ -100,7 +123,7 @@ const server = http.createServer(async (req, res) => {
     let target = '';
     for (const file of profiles) {
       console.info('writing file', file.filename);
-      if (!file.filename.includes('syms.json')) {
+      if (file.filename.endsWith('.json.gz') || (file.filename.endsWith('.perf.data') && target == '')) {
         target = file.filename;
       }
       writeFileSync(join(tmp, file.filename), file.content);
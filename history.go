@@ -0,0 +1,293 @@
+package main
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// MedianCI returns distribution-free confidence interval for the median built from the order statistics;
+// for small samples (e.g. less than 6 values for 95%) the interval is [min, max] and its coverage is lower than requested
+func MedianCI(values []float64, confidence float64) (float64, float64) {
+	if len(values) == 0 {
+		return 0, 0
+	}
+	sorted := slices.Clone(values)
+	slices.Sort(sorted)
+	n := len(sorted)
+	// k is the largest index such that P(Binomial(n, 1/2) <= k) <= (1 - confidence) / 2
+	k, cdf, probability := -1, 0.0, math.Pow(0.5, float64(n))
+	for j := 0; j < n/2; j++ {
+		cdf += probability
+		if cdf > (1-confidence)/2 {
+			break
+		}
+		k = j
+		probability = probability * float64(n-j) / float64(j+1)
+	}
+	k = max(k, 0)
+	return sorted[k], sorted[n-1-k]
+}
+
+// HostFingerprint identifies host configuration of the benchmark from its parameters
+func HostFingerprint(parameters map[string]string) string {
+	if fingerprint, ok := parameters["fingerprint"]; ok {
+		return fingerprint
+	}
+	fields := make([]string, 0)
+	for _, name := range []string{"arch", "hostname", "platform", "cpu", "ram"} {
+		fields = append(fields, fmt.Sprintf("%v=%v", name, parameters[name]))
+	}
+	hash := sha256.Sum256([]byte(strings.Join(fields, "\n")))
+	return hex.EncodeToString(hash[:8])
+}
+
+// HistoryHost identifies the machine of the benchmark in history: series of the same host stay continuous when
+// its environment fingerprint changes (e.g. after kernel update) and benchmarks recorded before fingerprints
+// were introduced match by the same hostname and arch as in comparableHosts
+func HistoryHost(parameters map[string]string) string {
+	return fmt.Sprintf("%v/%v", parameters["hostname"], parameters["arch"])
+}
+
+// CommitTimes resolves committer dates of the revisions; lookups (including failed ones) are cached
+type CommitTimes struct {
+	// Local is the git checkout of the repo (optional): revisions present in it are resolved without network requests
+	Local string
+	// Remote enables GitHub API requests for revisions absent in the Local checkout; it is disabled while benchmarks
+	// are running (commit times missing in history are filled by the backfill command)
+	Remote bool
+	// Token authenticates GitHub API requests (unauthenticated requests are limited to 60 per hour)
+	Token string
+
+	cache map[string]time.Time
+}
+
+// Lookup returns committer date of the revision or error if it is unknown (e.g. for RevisionWorkingTree)
+func (c *CommitTimes) Lookup(repo string, revision string) (time.Time, error) {
+	if revision == RevisionWorkingTree {
+		return time.Time{}, fmt.Errorf("commit time is unknown for %v", revision)
+	}
+	if c.cache == nil {
+		c.cache = make(map[string]time.Time)
+	}
+	key := fmt.Sprintf("%v:%v", repo, revision)
+	if commitTime, ok := c.cache[key]; ok {
+		if commitTime.IsZero() {
+			return time.Time{}, fmt.Errorf("commit time of %v is unknown", key)
+		}
+		return commitTime, nil
+	}
+	commitTime, err := c.lookup(repo, revision)
+	c.cache[key] = commitTime
+	return commitTime, err
+}
+
+func (c *CommitTimes) lookup(repo string, revision string) (time.Time, error) {
+	var localErr error
+	if c.Local != "" {
+		output, err := git(c.Local, nil, "show", "-s", "--format=%cI", revision+"^{commit}")
+		if err == nil {
+			return time.Parse(time.RFC3339, output)
+		}
+		localErr = err
+	}
+	if !c.Remote {
+		return time.Time{}, fmt.Errorf("revision is not found in the local checkout %q and remote lookup is disabled: %w", c.Local, localErr)
+	}
+	return GitHubCommitTime(repo, revision, c.Token)
+}
+
+// GitHubCommitTime fetches committer date of the revision from GitHub API (token is optional)
+func GitHubCommitTime(repo string, revision string, token string) (time.Time, error) {
+	var commit struct {
+		Commit struct {
+			Committer struct {
+				Date time.Time `json:"date"`
+			} `json:"committer"`
+		} `json:"commit"`
+	}
+	downloader := &Downloader{
+		Client:  &http.Client{Timeout: 10 * time.Second},
+		Retries: 1,
+		Backoff: time.Second,
+		Header:  http.Header{"Accept": {"application/vnd.github+json"}},
+	}
+	if token != "" {
+		downloader.Header.Set("Authorization", "Bearer "+token)
+	}
+	url := fmt.Sprintf("https://api.github.com/repos/%v/commits/%v", repo, revision)
+	err := downloader.Fetch(url, func(reader io.Reader) error {
+		return json.NewDecoder(reader).Decode(&commit)
+	})
+	if err != nil {
+		return time.Time{}, err
+	}
+	return commit.Commit.Committer.Date, nil
+}
+
+// historyRunner maps runner of the results db to the runner of the history: instances built from other revisions
+// of the compare benchmark are excluded (as their samples belong to the benchmarks of these revisions) and the compare
+// label (see InstanceTurso.Label) is stripped from the instance built from the benchmark revision to keep the series
+func historyRunner(parameters map[string]string, runner string, revision string) (string, bool) {
+	built, ok := parameters[runner+".revision"]
+	if !ok {
+		return runner, true
+	}
+	if built != revision {
+		return "", false
+	}
+	return strings.TrimSuffix(runner, "-"+shortRevision(revision)), true
+}
+
+// SummarizeBenchmark converts samples of the results db into history entries (one per runner, query and measurement)
+func SummarizeBenchmark(storage *Storage, resultsDb *sql.DB, benchmark BenchmarkInfo, commitTime time.Time) ([]HistoryEntry, error) {
+	parameters, err := storage.Parameters(resultsDb)
+	if err != nil {
+		return nil, err
+	}
+	samples, err := storage.Samples(resultsDb, benchmark.Dataset)
+	if err != nil {
+		return nil, err
+	}
+	fingerprint, host := HostFingerprint(parameters), HistoryHost(parameters)
+	entries := make([]HistoryEntry, 0, len(samples))
+	for key, values := range samples {
+		runner, ok := historyRunner(parameters, key.Runner, benchmark.Revision)
+		if !ok {
+			continue
+		}
+		low, high := MedianCI(values, 0.95)
+		entries = append(entries, HistoryEntry{
+			Repo:        benchmark.Repo,
+			Branch:      benchmark.Branch,
+			Revision:    benchmark.Revision,
+			CommitTime:  commitTime,
+			Fingerprint: fingerprint,
+			Host:        host,
+			Results:     benchmark.Results,
+			Runner:      runner,
+			Dataset:     benchmark.Dataset,
+			Name:        key.Name,
+			Measurement: key.Measurement,
+			Samples:     len(values),
+			Median:      median(values),
+			CILow:       low,
+			CIHigh:      high,
+		})
+	}
+	return entries, nil
+}
+
+// AppendHistory summarizes the benchmark into the history table of the meta db (commit time is optional)
+func AppendHistory(storage *Storage, meta *sql.DB, resultsDb *sql.DB, benchmark BenchmarkInfo, commitTimes *CommitTimes) error {
+	commitTime, err := commitTimes.Lookup(benchmark.Repo, benchmark.Revision)
+	if err != nil {
+		Logger.Warnf("failed to resolve commit time of %v:%v: %v", benchmark.Repo, benchmark.Revision, err)
+	}
+	entries, err := SummarizeBenchmark(storage, resultsDb, benchmark, commitTime)
+	if err != nil {
+		return err
+	}
+	return storage.AddHistory(meta, entries)
+}
+
+// CommandBackfill ingests finished benchmarks which are absent in the history table and fills hosts and commit
+// times missing in the history (remote lookup is enabled for the command)
+func CommandBackfill(storage *Storage, meta string, commitTimes CommitTimes, args []string) error {
+	flags := flag.NewFlagSet("backfill", flag.ContinueOnError)
+	var (
+		dataset = flags.String("dataset", "", "ingest only benchmarks of the dataset")
+		branch  = flags.String("branch", "", "ingest only benchmarks of the branch")
+		force   = flags.Bool("force", false, "re-ingest benchmarks which are already in the history table")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	metaDb, err := storage.ConnectDb(meta)
+	if err != nil {
+		return err
+	}
+	defer metaDb.Close()
+	if err := storage.InitBenchmarkMeta(metaDb); err != nil {
+		return err
+	}
+	benchmarks, err := storage.FinishedBenchmarks(metaDb)
+	if err != nil {
+		return err
+	}
+	ingested, err := storage.HistoryResults(metaDb)
+	if err != nil {
+		return err
+	}
+	commitTimes.Remote = true
+	count := 0
+	for _, benchmark := range benchmarks {
+		if (*dataset != "" && benchmark.Dataset != *dataset) || (*branch != "" && benchmark.Branch != *branch) {
+			continue
+		}
+		if ingested[benchmark.Results] && !*force {
+			continue
+		}
+		Logger.Infof("backfill history from %v (%v)", benchmark, benchmark.Results)
+		resultsDb, err := storage.ConnectDb(benchmark.Results)
+		if err != nil {
+			return err
+		}
+		err = AppendHistory(storage, metaDb, resultsDb, benchmark, &commitTimes)
+		resultsDb.Close()
+		if err != nil {
+			return fmt.Errorf("failed to backfill history from %v: %w", benchmark.Results, err)
+		}
+		count++
+	}
+	Logger.Infof("backfilled history from %v benchmarks", count)
+
+	// history ingested before hosts were recorded
+	unknown, err := storage.MissingHosts(metaDb)
+	if err != nil {
+		return err
+	}
+	for _, results := range unknown {
+		resultsDb, err := storage.ConnectDb(results)
+		if err != nil {
+			return err
+		}
+		parameters, err := storage.Parameters(resultsDb)
+		resultsDb.Close()
+		if err != nil {
+			return fmt.Errorf("failed to read parameters of %v: %w", results, err)
+		}
+		if err := storage.SetHistoryHost(metaDb, results, HistoryHost(parameters)); err != nil {
+			return err
+		}
+	}
+	Logger.Infof("filled hosts of %v results", len(unknown))
+
+	missing, err := storage.MissingCommitTimes(metaDb)
+	if err != nil {
+		return err
+	}
+	filled := 0
+	for _, benchmark := range missing {
+		commitTime, err := commitTimes.Lookup(benchmark.Repo, benchmark.Revision)
+		if err != nil {
+			Logger.Warnf("failed to resolve commit time of %v:%v: %v", benchmark.Repo, benchmark.Revision, err)
+			continue
+		}
+		if err := storage.SetCommitTime(metaDb, benchmark.Repo, benchmark.Revision, commitTime); err != nil {
+			return err
+		}
+		filled++
+	}
+	Logger.Infof("filled commit times of %v/%v revisions", filled, len(missing))
+	return nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMedianCI(t *testing.T) {
+	low, high := MedianCI([]float64{5, 1, 4, 2, 3}, 0.95)
+	require.Equal(t, 1.0, low)
+	require.Equal(t, 5.0, high)
+
+	values := make([]float64, 0)
+	for i := 20; i >= 1; i-- {
+		values = append(values, float64(i))
+	}
+	low, high = MedianCI(values, 0.95)
+	require.Equal(t, 6.0, low)
+	require.Equal(t, 15.0, high)
+
+	low, high = MedianCI([]float64{7}, 0.95)
+	require.Equal(t, 7.0, low)
+	require.Equal(t, 7.0, high)
+}
+
+func TestHostFingerprint(t *testing.T) {
+	parameters := map[string]string{"arch": "amd64", "hostname": "runner-1", "platform": "ubuntu", "cpu": "16", "ram": "64", "revision": "a"}
+	fingerprint := HostFingerprint(parameters)
+	require.Len(t, fingerprint, 16)
+
+	parameters["revision"] = "b"
+	require.Equal(t, fingerprint, HostFingerprint(parameters))
+	parameters["hostname"] = "runner-2"
+	require.NotEqual(t, fingerprint, HostFingerprint(parameters))
+	parameters["fingerprint"] = "stored"
+	require.Equal(t, "stored", HostFingerprint(parameters))
+	// history of the host is continuous across fingerprint changes
+	require.Equal(t, "runner-2/amd64", HistoryHost(parameters))
+}
+
+func TestHistoryRunner(t *testing.T) {
+	parameters := map[string]string{
+		"turso-aaaaaaaa.revision": "aaaaaaaaaaaa",
+		"turso-cccccccc.revision": "cccccccccccc",
+	}
+	runner, ok := historyRunner(parameters, "turso-aaaaaaaa", "aaaaaaaaaaaa")
+	require.True(t, ok)
+	require.Equal(t, "turso", runner)
+	_, ok = historyRunner(parameters, "turso-cccccccc", "aaaaaaaaaaaa")
+	require.False(t, ok)
+	runner, ok = historyRunner(parameters, "sqlite", "aaaaaaaaaaaa")
+	require.True(t, ok)
+	require.Equal(t, "sqlite", runner)
+}
+
+func TestCommitTimesLocal(t *testing.T) {
+	repo := t.TempDir()
+	_, err := git(repo, nil, "init", "-q")
+	require.Nil(t, err)
+	_, err = git(repo, []string{"GIT_COMMITTER_DATE=2025-03-01T10:00:00Z"}, "-c", "user.name=test", "-c", "user.email=test@test", "commit", "-q", "--allow-empty", "-m", "init")
+	require.Nil(t, err)
+	revision, err := git(repo, nil, "rev-parse", "HEAD")
+	require.Nil(t, err)
+
+	commitTimes := CommitTimes{Local: repo}
+	commitTime, err := commitTimes.Lookup("tursodatabase/turso", revision)
+	require.Nil(t, err)
+	require.True(t, time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC).Equal(commitTime))
+
+	_, err = commitTimes.Lookup("tursodatabase/turso", RevisionWorkingTree)
+	require.NotNil(t, err)
+	// unknown revisions are not looked up remotely while benchmarks are running
+	_, err = commitTimes.Lookup("tursodatabase/turso", "0123456789abcdef0123456789abcdef01234567")
+	require.ErrorContains(t, err, "remote lookup is disabled")
+}
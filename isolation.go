@@ -0,0 +1,132 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Isolation restricts benchmarked processes: they are pinned to the CPUs and moved into the cgroup v2 (with optional
+// limits) by the harness itself when the process is spawned (linux only), so no wrapper process adds to the measured
+// time and warmup, measured and profiled runs are isolated in the same way
+type Isolation struct {
+	// CPUs is the cpu list in the taskset format (e.g. "2-5,7")
+	CPUs string
+	// Cgroup is the path to the cgroup v2 directory (e.g. /sys/fs/cgroup/benchmark.slice/turso), created if missing
+	Cgroup string
+	// MemoryMax and CPUMax are written to the memory.max and cpu.max files of the cgroup (if set)
+	MemoryMax string
+	CPUMax    string
+}
+
+// ParseCPUList parses comma separated list of cpu numbers and ranges
+func ParseCPUList(list string) ([]int, error) {
+	cpus := make([]int, 0)
+	for _, item := range strings.Split(list, ",") {
+		first, last, isRange := strings.Cut(strings.TrimSpace(item), "-")
+		start, err := strconv.Atoi(first)
+		if err != nil || start < 0 {
+			return nil, fmt.Errorf("invalid cpu list %q: %v", list, item)
+		}
+		end := start
+		if isRange {
+			end, err = strconv.Atoi(last)
+			if err != nil || end < start {
+				return nil, fmt.Errorf("invalid cpu list %q: %v", list, item)
+			}
+		}
+		for cpu := start; cpu <= end; cpu++ {
+			cpus = append(cpus, cpu)
+		}
+	}
+	return cpus, nil
+}
+
+// Setup validates the configuration, prepares the cgroup with its limits and verifies that the harness can spawn
+// isolated process (e.g. cgroup subtree is delegated to the harness user)
+func (i Isolation) Setup() error {
+	if i.CPUs != "" {
+		if _, err := ParseCPUList(i.CPUs); err != nil {
+			return err
+		}
+	}
+	if i.Cgroup == "" {
+		if i.MemoryMax != "" || i.CPUMax != "" {
+			return fmt.Errorf("cgroup must be set for memory and cpu limits")
+		}
+		return i.probe()
+	}
+	if err := os.MkdirAll(i.Cgroup, 0o755); err != nil {
+		return fmt.Errorf("failed to create cgroup %v: %w", i.Cgroup, err)
+	}
+	controllers := make([]string, 0)
+	if i.CPUMax != "" {
+		controllers = append(controllers, "+cpu")
+	}
+	if i.MemoryMax != "" {
+		controllers = append(controllers, "+memory")
+	}
+	if len(controllers) > 0 {
+		// controllers can be already enabled by the administrator of the delegated subtree
+		control := filepath.Join(filepath.Dir(i.Cgroup), "cgroup.subtree_control")
+		if err := os.WriteFile(control, []byte(strings.Join(controllers, " ")), 0o644); err != nil {
+			Logger.Warnf("failed to enable controllers %v in %v: %v", controllers, control, err)
+		}
+	}
+	for name, value := range map[string]string{"cpu.max": i.CPUMax, "memory.max": i.MemoryMax} {
+		if value == "" {
+			continue
+		}
+		if err := os.WriteFile(filepath.Join(i.Cgroup, name), []byte(value), 0o644); err != nil {
+			return fmt.Errorf("failed to set %v of cgroup %v: %w", name, i.Cgroup, err)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(i.Cgroup, "cgroup.procs")); errors.Is(err, os.ErrNotExist) {
+		return fmt.Errorf("%v is not a cgroup v2 directory", i.Cgroup)
+	}
+	return i.probe()
+}
+
+// probe spawns trivial process with the isolation applied
+func (i Isolation) probe() error {
+	if i.CPUs == "" && i.Cgroup == "" {
+		return nil
+	}
+	if output, err := i.CombinedOutput(exec.Command("true")); err != nil {
+		return fmt.Errorf("failed to spawn process in cgroup %q pinned to cpus %q (is cgroup delegated to the harness user?): err=%w, out=%v", i.Cgroup, i.CPUs, err, string(output))
+	}
+	return nil
+}
+
+// Start starts the command with the isolation applied
+func (i Isolation) Start(cmd *exec.Cmd) error {
+	if i.CPUs == "" && i.Cgroup == "" {
+		return cmd.Start()
+	}
+	return i.start(cmd)
+}
+
+// CombinedOutput runs the command with the isolation applied and returns its combined stdout and stderr
+func (i Isolation) CombinedOutput(cmd *exec.Cmd) ([]byte, error) {
+	var output bytes.Buffer
+	cmd.Stdout, cmd.Stderr = &output, &output
+	if err := i.Start(cmd); err != nil {
+		return nil, err
+	}
+	err := cmd.Wait()
+	return output.Bytes(), err
+}
+
+func (i Isolation) Parameters() map[string]any {
+	return map[string]any{
+		"isolation.cpus":       i.CPUs,
+		"isolation.cgroup":     i.Cgroup,
+		"isolation.memory_max": i.MemoryMax,
+		"isolation.cpu_max":    i.CPUMax,
+	}
+}
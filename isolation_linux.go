@@ -0,0 +1,50 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/exec"
+	"runtime"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// start spawns the process directly into the cgroup (clone3 with CLONE_INTO_CGROUP) from the thread pinned to the CPUs,
+// so the child inherits affinity before exec and no process is ever executed outside of the isolation
+func (i Isolation) start(cmd *exec.Cmd) error {
+	if i.Cgroup != "" {
+		cgroup, err := os.Open(i.Cgroup)
+		if err != nil {
+			return fmt.Errorf("failed to open cgroup %v: %w", i.Cgroup, err)
+		}
+		defer cgroup.Close()
+		if cmd.SysProcAttr == nil {
+			cmd.SysProcAttr = &syscall.SysProcAttr{}
+		}
+		cmd.SysProcAttr.UseCgroupFD = true
+		cmd.SysProcAttr.CgroupFD = int(cgroup.Fd())
+	}
+	if i.CPUs == "" {
+		return cmd.Start()
+	}
+	cpus, err := ParseCPUList(i.CPUs)
+	if err != nil {
+		return err
+	}
+	var pinned unix.CPUSet
+	for _, cpu := range cpus {
+		pinned.Set(cpu)
+	}
+	started := make(chan error)
+	go func() {
+		// thread is never unlocked, so it is terminated together with the goroutine and its affinity doesn't leak
+		runtime.LockOSThread()
+		if err := unix.SchedSetaffinity(0, &pinned); err != nil {
+			started <- fmt.Errorf("failed to pin to cpus %v: %w", i.CPUs, err)
+			return
+		}
+		started <- cmd.Start()
+	}()
+	return <-started
+}
@@ -0,0 +1,13 @@
+//go:build !linux
+
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"runtime"
+)
+
+func (i Isolation) start(_ *exec.Cmd) error {
+	return fmt.Errorf("unable to isolate process for platform '%v'", runtime.GOOS)
+}
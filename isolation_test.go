@@ -0,0 +1,54 @@
+package main
+
+import (
+	"os/exec"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseCPUList(t *testing.T) {
+	cpus, err := ParseCPUList("2-4,7, 9")
+	require.Nil(t, err)
+	require.Equal(t, []int{2, 3, 4, 7, 9}, cpus)
+
+	for _, invalid := range []string{"", "a", "4-2", "-1", "1,"} {
+		_, err := ParseCPUList(invalid)
+		require.NotNil(t, err, invalid)
+	}
+}
+
+func TestIsolationStart(t *testing.T) {
+	output, err := Isolation{}.CombinedOutput(exec.Command("echo", "ok"))
+	require.Nil(t, err)
+	require.Equal(t, "ok\n", string(output))
+
+	if runtime.GOOS != "linux" {
+		t.Skip("isolation is supported only on linux")
+	}
+	// affinity is applied to the spawned process itself without wrappers
+	output, err = Isolation{CPUs: "0"}.CombinedOutput(exec.Command("grep", "Cpus_allowed_list", "/proc/self/status"))
+	require.Nil(t, err)
+	require.Equal(t, "0", strings.TrimSpace(strings.TrimPrefix(string(output), "Cpus_allowed_list:")))
+	require.Nil(t, Isolation{CPUs: "0"}.Setup())
+
+	require.ErrorContains(t, Isolation{Cgroup: t.TempDir()}.Setup(), "is not a cgroup v2 directory")
+	require.NotNil(t, Isolation{CPUMax: "50000 100000"}.Setup())
+	require.NotNil(t, Isolation{CPUs: "x"}.Setup())
+}
+
+func TestIsolationFingerprint(t *testing.T) {
+	environment := map[string]string{"env.arch": "amd64", "env.cpu_model": "AMD EPYC 9454P"}
+	fingerprint := EnvironmentFingerprint(environment)
+	// empty isolation keeps fingerprints recorded before isolation was introduced
+	environment["isolation.cpus"] = ""
+	require.Equal(t, fingerprint, EnvironmentFingerprint(environment))
+	environment["isolation.cpus"] = "2-3"
+	require.NotEqual(t, fingerprint, EnvironmentFingerprint(environment))
+
+	legacy := map[string]string{"hostname": "runner-1", "arch": "amd64"}
+	require.True(t, comparableHosts(legacy, map[string]string{"hostname": "runner-1", "arch": "amd64"}))
+	require.False(t, comparableHosts(legacy, map[string]string{"hostname": "runner-1", "arch": "amd64", "isolation.cpus": "2-3"}))
+}
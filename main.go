@@ -2,9 +2,13 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
 	"os/signal"
 	"strconv"
+	"strings"
 	"syscall"
 	"time"
 
@@ -32,6 +36,49 @@ func IntEnv(key string, def int) int {
 	return parsed
 }
 
+func FloatEnv(key string, def float64) float64 {
+	value, ok := os.LookupEnv(key)
+	if !ok {
+		return def
+	}
+	parsed, err := strconv.ParseFloat(value, 64)
+	if err != nil {
+		return def
+	}
+	return parsed
+}
+
+// TursoBuild describes turso build configuration in the TURSO_BUILDS env var, for example:
+// [{"profile":"release"},{"variant":"release-native","profile":"release","rustflags":"-C target-cpu=native"}]
+type TursoBuild struct {
+	Variant   string   `json:"variant"`
+	Profile   string   `json:"profile"`
+	Features  []string `json:"features"`
+	RustFlags string   `json:"rustflags"`
+	Allocator string   `json:"allocator"`
+}
+
+// ParseTursoBuilds parses TURSO_BUILDS: every build must set the cargo profile and builds must have distinct variants
+// (runners with the same name would be deduplicated silently)
+func ParseTursoBuilds(spec string) ([]TursoBuild, error) {
+	var builds []TursoBuild
+	if err := json.Unmarshal([]byte(spec), &builds); err != nil {
+		return nil, err
+	}
+	names := make(map[string]bool, len(builds))
+	for i, build := range builds {
+		if build.Profile == "" {
+			return nil, fmt.Errorf("turso build #%v has no profile", i)
+		}
+		name := (&RunnerTurso{Variant: build.Variant}).Name()
+		if names[name] {
+			return nil, fmt.Errorf("duplicate turso build %v: set distinct variants", name)
+		}
+		names[name] = true
+	}
+	return builds, nil
+}
+
 func main() {
 	err := godotenv.Load()
 	if err != nil {
@@ -39,28 +86,108 @@ func main() {
 	}
 
 	var (
-		TURSO_ORG_NAME   = StringEnv("TURSO_ORG_NAME", "sivukhin")
-		TURSO_GROUP_NAME = StringEnv("TURSO_GROUP_NAME", "turso-benchmark")
-		TURSO_API_TOKEN  = StringEnv("TURSO_API_TOKEN", "")
-		TURSO_AUTH_TOKEN = StringEnv("TURSO_AUTH_TOKEN", "")
-		TURSO_META_NAME  = StringEnv("TURSO_META_NAME", "")
-		RUNNER_ID        = StringEnv("RUNNER_ID", "")
-		RUNNER_DIR       = StringEnv("RUNNER_DIR", ".runner")
+		TURSO_ORG_NAME    = StringEnv("TURSO_ORG_NAME", "sivukhin")
+		TURSO_GROUP_NAME  = StringEnv("TURSO_GROUP_NAME", "turso-benchmark")
+		TURSO_API_TOKEN   = StringEnv("TURSO_API_TOKEN", "")
+		TURSO_AUTH_TOKEN  = StringEnv("TURSO_AUTH_TOKEN", "")
+		TURSO_META_NAME   = StringEnv("TURSO_META_NAME", "")
+		RUNNER_ID         = StringEnv("RUNNER_ID", "")
+		RUNNER_DIR        = StringEnv("RUNNER_DIR", ".runner")
+		DUCKDB_BINARY     = StringEnv("DUCKDB_BINARY", "")
+		TURSO_LOCAL_REPO  = StringEnv("TURSO_LOCAL_REPO", "")
+		TURSO_CACHE_GB    = IntEnv("TURSO_CACHE_GB", 0)
+		TURSO_CLEAN_BUILD = IntEnv("TURSO_CLEAN_BUILD", 0)
+		TURSO_BUILDS      = StringEnv("TURSO_BUILDS", `[{"profile":"release"}]`)
+		SQLITE_VERSIONS   = StringEnv("SQLITE_VERSIONS", "")
+		SQLITE_OPTIONS    = StringEnv("SQLITE_OPTIONS", "-O2 -DSQLITE_THREADSAFE=0 -DSQLITE_ENABLE_MATH_FUNCTIONS")
+		SQLITE_CC         = StringEnv("SQLITE_CC", "cc")
+		BENCHMARK_ORDER   = StringEnv("BENCHMARK_ORDER", OrderInterleaved)
+		BENCHMARK_SEED    = IntEnv("BENCHMARK_SEED", 0)
+		PROFILERS         = StringEnv("PROFILERS", "samply")
+		PROFILING         = StringEnv("PROFILING", ProfilingAll)
+		BASELINE_BRANCH   = StringEnv("BASELINE_BRANCH", "main")
+		PROFILE_BUDGET_MB = IntEnv("PROFILE_BUDGET_MB", 0)
+		NOISE_POLICY      = StringEnv("NOISE_POLICY", NoiseWarn)
+		NOISE_MAX_LOAD    = FloatEnv("NOISE_MAX_LOAD", 0.5)
+		NOISE_MAX_CPU     = FloatEnv("NOISE_MAX_CPU", 10)
+		NOISE_GOVERNOR    = StringEnv("NOISE_GOVERNOR", "performance")
+		NOISE_WINDOW_MS   = IntEnv("NOISE_WINDOW_MS", 1000)
+		NOISE_TIMEOUT_SEC = IntEnv("NOISE_TIMEOUT_SEC", 600)
+		BENCHMARK_CPUS    = StringEnv("BENCHMARK_CPUS", "")
+		BENCHMARK_CGROUP  = StringEnv("BENCHMARK_CGROUP", "")
+		CGROUP_MEMORY_MAX = StringEnv("CGROUP_MEMORY_MAX", "")
+		CGROUP_CPU_MAX    = StringEnv("CGROUP_CPU_MAX", "")
+		CACHE_MODES       = StringEnv("CACHE_MODES", CacheCold)
+		QUERY_TIMEOUT_SEC = IntEnv("QUERY_TIMEOUT_SEC", 3600)
+		GITHUB_TOKEN      = StringEnv("GITHUB_TOKEN", "")
 	)
 
+	if err := ValidateNoisePolicy(NOISE_POLICY); err != nil {
+		Logger.Fatalf("invalid noise policy: %v", err)
+	}
+
+	profilers, err := ParseProfilers(PROFILERS)
+	if err != nil {
+		Logger.Fatalf("failed to parse profilers: %v", err)
+	}
+
+	cacheModes, err := ParseCacheModes(CACHE_MODES)
+	if err != nil {
+		Logger.Fatalf("failed to parse cache modes: %v", err)
+	}
+
+	builds, err := ParseTursoBuilds(TURSO_BUILDS)
+	if err != nil {
+		Logger.Fatalf("failed to parse turso builds: %v", err)
+	}
+
+	runners := []Runner{&RunnerSqlite{}}
+	for _, build := range builds {
+		runners = append(runners, &RunnerTurso{
+			Path:       RUNNER_DIR,
+			Profile:    build.Profile,
+			Variant:    build.Variant,
+			Features:   build.Features,
+			RustFlags:  build.RustFlags,
+			Allocator:  build.Allocator,
+			Local:      TURSO_LOCAL_REPO,
+			CacheLimit: int64(TURSO_CACHE_GB) * 1024 * 1024 * 1024,
+			CleanBuild: TURSO_CLEAN_BUILD != 0,
+		})
+	}
+	for _, version := range strings.Split(SQLITE_VERSIONS, ",") {
+		version = strings.TrimSpace(version)
+		if version == "" {
+			continue
+		}
+		runners = append(runners, &RunnerSqliteBuild{
+			Path:     RUNNER_DIR,
+			Version:  version,
+			Compiler: SQLITE_CC,
+			Options:  strings.Fields(SQLITE_OPTIONS),
+		})
+	}
+	if DUCKDB_BINARY != "" {
+		runners = append(runners, &RunnerDuckdb{Binary: DUCKDB_BINARY})
+	}
+
 	system := System{
 		storage: Storage{
 			OrgName:   TURSO_ORG_NAME,
 			GroupName: TURSO_GROUP_NAME,
 			ApiToken:  TURSO_API_TOKEN,
 			AuthToken: TURSO_AUTH_TOKEN,
+
+			ProfileChunkSize: 1024 * 1024,
+			ProfileBudget:    int64(PROFILE_BUDGET_MB) * 1024 * 1024,
 		},
-		id:   RUNNER_ID,
-		meta: TURSO_META_NAME,
-		path: RUNNER_DIR,
-		runners: []Runner{
-			&RunnerSqlite{},
-			&RunnerTurso{Profile: "release", Path: RUNNER_DIR},
+		id:      RUNNER_ID,
+		meta:    TURSO_META_NAME,
+		path:    RUNNER_DIR,
+		runners: runners,
+		commitTimes: CommitTimes{
+			Local: TURSO_LOCAL_REPO,
+			Token: GITHUB_TOKEN,
 		},
 		datatsets: []Dataset{
 			&DatasetClickhouse{Rows: 1000000},
@@ -69,14 +196,51 @@ func main() {
 			&DatasetVectorsSparse{},
 		},
 		benchmark: Benchmark{
-			Warmup:      2,
-			Attempts:    5,
-			ClearCaches: true,
+			Warmup:     2,
+			Attempts:   5,
+			CacheModes: cacheModes,
+			NetTime:    true,
+			Order:      BENCHMARK_ORDER,
+			Seed:       int64(BENCHMARK_SEED),
+			Profilers:  profilers,
+			Profiling:  PROFILING,
+
+			BaselineBranch:      BASELINE_BRANCH,
+			RegressionThreshold: 0.05,
+			Noise: NoiseConfig{
+				Policy:   NOISE_POLICY,
+				MaxLoad:  NOISE_MAX_LOAD,
+				MaxCPU:   NOISE_MAX_CPU,
+				Governor: NOISE_GOVERNOR,
+				Window:   time.Duration(NOISE_WINDOW_MS) * time.Millisecond,
+				Timeout:  time.Duration(NOISE_TIMEOUT_SEC) * time.Second,
+			},
+			Isolation: Isolation{
+				CPUs:      BENCHMARK_CPUS,
+				Cgroup:    BENCHMARK_CGROUP,
+				MemoryMax: CGROUP_MEMORY_MAX,
+				CPUMax:    CGROUP_CPU_MAX,
+			},
+			Timeout: time.Duration(QUERY_TIMEOUT_SEC) * time.Second,
 		},
 		errorDelay: 5 * time.Second,
 		sleepDelay: 1 * time.Second,
 	}
 
+	if len(os.Args) > 1 {
+		err = RunCommand(&system, os.Args[1], os.Args[2:])
+		var regressionErr *RegressionError
+		if errors.As(err, &regressionErr) {
+			Logger.Errorf("command %v failed: %v", os.Args[1], err)
+			Logger.Sync()
+			os.Exit(ExitRegression)
+		}
+		if err != nil {
+			Logger.Fatalf("command %v failed: %v", os.Args[1], err)
+		}
+		return
+	}
+
 	ctx, cancel := signal.NotifyContext(context.Background(), syscall.SIGTERM, syscall.SIGINT)
 	defer cancel()
 
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"fmt"
+	"runtime"
+	"strings"
+	"time"
+
+	"github.com/shirou/gopsutil/cpu"
+	"github.com/shirou/gopsutil/load"
+)
+
+const (
+	// NoiseOff disables noise checks
+	NoiseOff = "off"
+	// NoiseWarn records violations and continues the benchmark
+	NoiseWarn = "warn"
+	// NoiseWait waits until the machine is quiet (and aborts after the timeout); persistent violations
+	// (CPU governor) can't clear by waiting and are only recorded
+	NoiseWait = "wait"
+	// NoiseAbort aborts the benchmark immediately
+	NoiseAbort = "abort"
+)
+
+// PreflightName is the pseudo-query name for the noise check executed before the benchmark
+const PreflightName = "preflight"
+
+type NoiseConfig struct {
+	Policy string
+	// MaxLoad limits 1-minute load average per CPU
+	MaxLoad float64
+	// MaxCPU limits background CPU usage (percent of all CPUs) observed during the Window
+	MaxCPU float64
+	// Governor is the expected CPU frequency scaling governor (checked only if scaling is available)
+	Governor string
+	Window   time.Duration
+	// Timeout limits total time spent waiting for the quiet machine with NoiseWait policy
+	Timeout time.Duration
+}
+
+func ValidateNoisePolicy(policy string) error {
+	switch policy {
+	case NoiseOff, NoiseWarn, NoiseWait, NoiseAbort:
+		return nil
+	}
+	return fmt.Errorf("unknown noise policy: %v", policy)
+}
+
+type NoiseSample struct {
+	Load     float64
+	CPU      float64
+	Governor string
+}
+
+// NoiseRecord is the noise observed before the query execution
+type NoiseRecord struct {
+	Dataset    string
+	Name       string
+	Sample     NoiseSample
+	Violations []string
+	// Waited is the time spent waiting for the quiet machine
+	Waited time.Duration
+}
+
+// NoiseError aborts the benchmark and keeps the noise record with violations; aborted benchmark is postponed
+// with exponential backoff (see System.postpone)
+type NoiseError struct {
+	Record NoiseRecord
+}
+
+func (e *NoiseError) Error() string {
+	return fmt.Sprintf("machine is too noisy before %v/%v: %v", e.Record.Dataset, e.Record.Name, strings.Join(e.Record.Violations, ", "))
+}
+
+// MeasureNoise samples load average, CPU usage over the window and scaling governor of the first CPU
+func MeasureNoise(window time.Duration) (NoiseSample, error) {
+	average, err := load.Avg()
+	if err != nil {
+		return NoiseSample{}, err
+	}
+	usage, err := cpu.Percent(window, false)
+	if err != nil {
+		return NoiseSample{}, err
+	}
+	sample := NoiseSample{Load: average.Load1 / float64(runtime.NumCPU())}
+	if len(usage) > 0 {
+		sample.CPU = usage[0]
+	}
+	sample.Governor, _ = readTrimmed("/sys/devices/system/cpu/cpu0/cpufreq/scaling_governor")
+	return sample, nil
+}
+
+func (c NoiseConfig) Enabled() bool {
+	return c.Policy != NoiseOff && c.Policy != ""
+}
+
+// Transient returns violations which can clear by waiting (load and background CPU usage)
+func (c NoiseConfig) Transient(sample NoiseSample) []string {
+	violations := make([]string, 0)
+	if c.MaxLoad > 0 && sample.Load > c.MaxLoad {
+		violations = append(violations, fmt.Sprintf("load average per cpu %.2f > %.2f", sample.Load, c.MaxLoad))
+	}
+	if c.MaxCPU > 0 && sample.CPU > c.MaxCPU {
+		violations = append(violations, fmt.Sprintf("background cpu usage %.1f%% > %.1f%%", sample.CPU, c.MaxCPU))
+	}
+	return violations
+}
+
+func (c NoiseConfig) Violations(sample NoiseSample) []string {
+	violations := c.Transient(sample)
+	if c.Governor != "" && sample.Governor != "" && sample.Governor != c.Governor {
+		violations = append(violations, fmt.Sprintf("cpu governor %v != %v", sample.Governor, c.Governor))
+	}
+	return violations
+}
+
+// CheckNoise measures noise and applies the policy: violations are recorded for the NoiseWarn policy
+// and NoiseError is returned if benchmark must be aborted
+func (b *Benchmark) CheckNoise(dataset string, name string) (NoiseRecord, error) {
+	record := NoiseRecord{Dataset: dataset, Name: name}
+	if !b.Noise.Enabled() {
+		return record, nil
+	}
+	start := time.Now()
+	for {
+		sample, err := MeasureNoise(b.Noise.Window)
+		if err != nil {
+			return record, fmt.Errorf("failed to measure noise: %w", err)
+		}
+		violations := b.Noise.Violations(sample)
+		record.Sample, record.Waited = sample, time.Since(start)
+		if len(violations) == 0 {
+			return record, nil
+		}
+		record.Violations = violations
+		switch {
+		case b.Noise.Policy == NoiseWarn || (b.Noise.Policy == NoiseWait && len(b.Noise.Transient(sample)) == 0):
+			Logger.Warnf("noisy machine before %v/%v: %v", dataset, name, strings.Join(violations, ", "))
+			return record, nil
+		case b.Noise.Policy == NoiseAbort:
+			return record, &NoiseError{Record: record}
+		}
+		if record.Waited > b.Noise.Timeout {
+			return record, &NoiseError{Record: record}
+		}
+		record.Violations = nil
+		Logger.Infof("noisy machine before %v/%v, wait: %v", dataset, name, strings.Join(violations, ", "))
+		time.Sleep(max(b.Noise.Window, time.Second))
+	}
+}
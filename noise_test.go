@@ -0,0 +1,54 @@
+package main
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestNoiseViolations(t *testing.T) {
+	config := NoiseConfig{Policy: NoiseWarn, MaxLoad: 0.5, MaxCPU: 10, Governor: "performance"}
+	require.Empty(t, config.Violations(NoiseSample{Load: 0.1, CPU: 2, Governor: "performance"}))
+	// governor is not checked if frequency scaling is not available
+	require.Empty(t, config.Violations(NoiseSample{Load: 0.1, CPU: 2}))
+	require.Equal(t, []string{
+		"load average per cpu 0.75 > 0.50",
+		"background cpu usage 35.0% > 10.0%",
+		"cpu governor powersave != performance",
+	}, config.Violations(NoiseSample{Load: 0.75, CPU: 35, Governor: "powersave"}))
+
+	// governor does not clear by waiting
+	require.Empty(t, config.Transient(NoiseSample{Load: 0.1, CPU: 2, Governor: "powersave"}))
+	require.Len(t, config.Transient(NoiseSample{Load: 0.75, CPU: 2, Governor: "powersave"}), 1)
+
+	require.Empty(t, NoiseConfig{}.Violations(NoiseSample{Load: 10, CPU: 100, Governor: "powersave"}))
+}
+
+func TestCheckNoiseOff(t *testing.T) {
+	benchmark := Benchmark{Noise: NoiseConfig{Policy: NoiseOff, MaxCPU: 0.0001}}
+	record, err := benchmark.CheckNoise("tpch", "q1")
+	require.Nil(t, err)
+	require.Equal(t, NoiseRecord{Dataset: "tpch", Name: "q1"}, record)
+
+	require.Nil(t, ValidateNoisePolicy(NoiseWait))
+	require.NotNil(t, ValidateNoisePolicy("sleep"))
+}
+
+func TestPostponeNoisyBenchmark(t *testing.T) {
+	system := System{errorDelay: 5 * time.Second}
+	benchmark, other := BenchmarkInfo{Revision: "a", Dataset: "tpch"}, BenchmarkInfo{Revision: "b", Dataset: "tpch"}
+	now := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	require.True(t, system.ready(benchmark, now))
+
+	require.Equal(t, 5*time.Second, system.postpone(benchmark, now))
+	require.False(t, system.ready(benchmark, now.Add(4*time.Second)))
+	require.True(t, system.ready(other, now))
+	require.True(t, system.ready(benchmark, now.Add(5*time.Second)))
+
+	require.Equal(t, 10*time.Second, system.postpone(benchmark, now))
+	for i := 0; i < 20; i++ {
+		system.postpone(benchmark, now)
+	}
+	require.Equal(t, maxPostponeDelay, system.postpone(benchmark, now))
+}
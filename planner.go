@@ -0,0 +1,99 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+const (
+	// OrderSequential runs all attempts of the runner before switching to the next one (AAABBB)
+	OrderSequential = "sequential"
+	// OrderInterleaved interleaves attempts of the runners within every query (ABAB)
+	OrderInterleaved = "interleaved"
+	// OrderRoundRobin interleaves attempts across all queries and runners
+	OrderRoundRobin = "round-robin"
+	// OrderShuffle executes all attempts of all queries and runners in a random (seeded) order
+	OrderShuffle = "shuffle"
+)
+
+// Pair identifies the query and runner by their indices
+type Pair struct {
+	Query  int
+	Runner int
+}
+
+type Step struct {
+	Pair
+	Attempt int
+}
+
+// PlanGroups plans pairs of every group (in the order of the first appearance) separately and executes groups one
+// after another, so attempts of different groups never interleave (e.g. cold cache attempts do not evict caches
+// between attempts of the hot cache queries); order is applied within every group
+func PlanGroups(order string, pairs []Pair, group func(Pair) string, attempts int, seed int64) ([]Step, error) {
+	names := make([]string, 0)
+	groups := make(map[string][]Pair)
+	for _, pair := range pairs {
+		name := group(pair)
+		if _, ok := groups[name]; !ok {
+			names = append(names, name)
+		}
+		groups[name] = append(groups[name], pair)
+	}
+	if len(names) == 0 {
+		return Plan(order, pairs, attempts, seed)
+	}
+	steps := make([]Step, 0, len(pairs)*attempts)
+	for _, name := range names {
+		planned, err := Plan(order, groups[name], attempts, seed)
+		if err != nil {
+			return nil, err
+		}
+		steps = append(steps, planned...)
+	}
+	return steps, nil
+}
+
+// Plan produces execution order for the given pairs; pairs must be grouped by the query
+func Plan(order string, pairs []Pair, attempts int, seed int64) ([]Step, error) {
+	steps := make([]Step, 0, len(pairs)*attempts)
+	switch order {
+	case OrderSequential:
+		for _, pair := range pairs {
+			for i := 0; i < attempts; i++ {
+				steps = append(steps, Step{Pair: pair})
+			}
+		}
+	case OrderInterleaved:
+		for start := 0; start < len(pairs); {
+			end := start
+			for end < len(pairs) && pairs[end].Query == pairs[start].Query {
+				end++
+			}
+			for i := 0; i < attempts; i++ {
+				for _, pair := range pairs[start:end] {
+					steps = append(steps, Step{Pair: pair})
+				}
+			}
+			start = end
+		}
+	case OrderRoundRobin, OrderShuffle:
+		for i := 0; i < attempts; i++ {
+			for _, pair := range pairs {
+				steps = append(steps, Step{Pair: pair})
+			}
+		}
+		if order == OrderShuffle {
+			rng := rand.New(rand.NewSource(seed))
+			rng.Shuffle(len(steps), func(i, j int) { steps[i], steps[j] = steps[j], steps[i] })
+		}
+	default:
+		return nil, fmt.Errorf("unknown execution order: %v", order)
+	}
+	counters := make(map[Pair]int, len(pairs))
+	for i := range steps {
+		steps[i].Attempt = counters[steps[i].Pair]
+		counters[steps[i].Pair]++
+	}
+	return steps, nil
+}
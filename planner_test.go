@@ -0,0 +1,59 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func planPairs(steps []Step) []Pair {
+	pairs := make([]Pair, 0, len(steps))
+	for _, step := range steps {
+		pairs = append(pairs, step.Pair)
+	}
+	return pairs
+}
+
+func TestPlan(t *testing.T) {
+	a, b, c := Pair{Query: 0, Runner: 0}, Pair{Query: 0, Runner: 1}, Pair{Query: 1, Runner: 0}
+	pairs := []Pair{a, b, c}
+
+	steps, err := Plan(OrderSequential, pairs, 2, 0)
+	require.Nil(t, err)
+	require.Equal(t, []Pair{a, a, b, b, c, c}, planPairs(steps))
+
+	steps, err = Plan(OrderInterleaved, pairs, 2, 0)
+	require.Nil(t, err)
+	require.Equal(t, []Pair{a, b, a, b, c, c}, planPairs(steps))
+
+	steps, err = Plan(OrderRoundRobin, pairs, 2, 0)
+	require.Nil(t, err)
+	require.Equal(t, []Pair{a, b, c, a, b, c}, planPairs(steps))
+	require.Equal(t, 1, steps[5].Attempt)
+
+	first, err := Plan(OrderShuffle, pairs, 5, 42)
+	require.Nil(t, err)
+	second, err := Plan(OrderShuffle, pairs, 5, 42)
+	require.Nil(t, err)
+	require.Equal(t, first, second)
+	require.Len(t, first, 15)
+
+	_, err = Plan("unknown", pairs, 2, 0)
+	require.NotNil(t, err)
+}
+
+func TestPlanGroups(t *testing.T) {
+	pairs := []Pair{{0, 0}, {0, 1}, {1, 0}, {1, 1}, {2, 0}, {2, 1}}
+	caches := []string{CacheCold, CacheHot, CacheCold}
+	for _, order := range []string{OrderSequential, OrderInterleaved, OrderRoundRobin, OrderShuffle} {
+		steps, err := PlanGroups(order, pairs, func(pair Pair) string { return caches[pair.Query] }, 3, 1)
+		require.Nil(t, err)
+		require.Len(t, steps, 18)
+		// all cold attempts are executed before any hot attempt
+		for i, step := range steps {
+			require.Equal(t, i >= 12, caches[step.Query] == CacheHot, order)
+		}
+	}
+	_, err := PlanGroups("random", nil, func(Pair) string { return "" }, 3, 1)
+	require.NotNil(t, err)
+}
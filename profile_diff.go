@@ -0,0 +1,280 @@
+package main
+
+import (
+	"bytes"
+	"cmp"
+	"flag"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+)
+
+type FunctionStat struct {
+	Name string
+	// Self and Total are fractions of all samples where function is the leaf or present in the stack
+	Self  float64
+	Total float64
+}
+
+// FunctionStats aggregates folded stacks into per-function self and total shares (recursive frames are counted once)
+func FunctionStats(stacks []FoldedStack) map[string]FunctionStat {
+	samples := 0
+	for _, stack := range stacks {
+		samples += stack.Count
+	}
+	stats := make(map[string]FunctionStat, 0)
+	if samples == 0 {
+		return stats
+	}
+	for _, stack := range stacks {
+		share := float64(stack.Count) / float64(samples)
+		seen := make(map[string]bool, len(stack.Frames))
+		for i, frame := range stack.Frames {
+			stat := stats[frame]
+			stat.Name = frame
+			if i == len(stack.Frames)-1 {
+				stat.Self += share
+			}
+			if !seen[frame] {
+				seen[frame] = true
+				stat.Total += share
+			}
+			stats[frame] = stat
+		}
+	}
+	return stats
+}
+
+type FunctionDiff struct {
+	Name                   string
+	BaseSelf, TargetSelf   float64
+	BaseTotal, TargetTotal float64
+}
+
+func (d FunctionDiff) SelfDelta() float64 { return d.TargetSelf - d.BaseSelf }
+
+// DiffFunctions returns all functions ordered by the self share delta (largest gain first)
+func DiffFunctions(base, target map[string]FunctionStat) []FunctionDiff {
+	diffs := make([]FunctionDiff, 0)
+	for name := range base {
+		diffs = append(diffs, FunctionDiff{Name: name})
+	}
+	for name := range target {
+		if _, ok := base[name]; !ok {
+			diffs = append(diffs, FunctionDiff{Name: name})
+		}
+	}
+	for i := range diffs {
+		diffs[i].BaseSelf, diffs[i].BaseTotal = base[diffs[i].Name].Self, base[diffs[i].Name].Total
+		diffs[i].TargetSelf, diffs[i].TargetTotal = target[diffs[i].Name].Self, target[diffs[i].Name].Total
+	}
+	slices.SortFunc(diffs, func(a, b FunctionDiff) int {
+		if c := cmp.Compare(b.SelfDelta(), a.SelfDelta()); c != 0 {
+			return c
+		}
+		return strings.Compare(a.Name, b.Name)
+	})
+	return diffs
+}
+
+// DiffFlameTree builds flame tree of the target profile and annotates every node with the delta against
+// the base profile (scaled to the same number of samples)
+func DiffFlameTree(base, target []FoldedStack) *FlameNode {
+	baseRoot, targetRoot := BuildFlameTree(base), BuildFlameTree(target)
+	scale := 0.0
+	if baseRoot.Value > 0 {
+		scale = float64(targetRoot.Value) / float64(baseRoot.Value)
+	}
+	var annotate func(node *FlameNode, other *FlameNode)
+	annotate = func(node *FlameNode, other *FlameNode) {
+		previous := 0.0
+		if other != nil {
+			previous = float64(other.Value) * scale
+		}
+		node.Delta = node.Value - int(math.Round(previous))
+		for _, child := range node.Children {
+			var match *FlameNode
+			if other != nil {
+				for _, candidate := range other.Children {
+					if candidate.Name == child.Name {
+						match = candidate
+						break
+					}
+				}
+			}
+			annotate(child, match)
+		}
+	}
+	annotate(targetRoot, baseRoot)
+	return targetRoot
+}
+
+// DiffColor paints nodes which gained samples in red and nodes which lost samples in blue
+func DiffColor(node *FlameNode) string {
+	ratio := math.Min(1, math.Abs(float64(node.Delta))/float64(max(node.Value, 1)))
+	fade := int(255 * (1 - ratio))
+	if node.Delta > 0 {
+		return fmt.Sprintf("rgb(255,%v,%v)", fade, fade)
+	} else if node.Delta < 0 {
+		return fmt.Sprintf("rgb(%v,%v,255)", fade, fade)
+	}
+	return "rgb(235,235,235)"
+}
+
+// LoadFoldedProfile fetches profile of the query from profiles db and converts it to folded stacks
+func LoadFoldedProfile(storage *Storage, profilesName string, runner string, dataset string, name string) ([]FoldedStack, error) {
+	db, err := storage.ConnectDb(profilesName)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	files, err := storage.DownloadProfileDb(db, runner, dataset, name)
+	if err != nil {
+		return nil, err
+	}
+	for _, file := range files {
+		if strings.HasSuffix(file.Filename, ".folded") {
+			return ParseFolded(bytes.NewReader(file.Content))
+		}
+	}
+	tmp, err := os.MkdirTemp("", "turso-benchmark-profile")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmp)
+	var profile, syms string
+	for _, file := range files {
+		filename := filepath.Join(tmp, filepath.Base(file.Filename))
+		if err := os.WriteFile(filename, file.Content, 0o644); err != nil {
+			return nil, err
+		}
+		if strings.HasSuffix(file.Filename, ".json.gz") {
+			profile = filename
+		} else if strings.HasSuffix(file.Filename, ".syms.json") {
+			syms = filename
+		}
+	}
+	if profile == "" {
+		return nil, fmt.Errorf("profile for %v/%v/%v not found in %v", runner, dataset, name, profilesName)
+	}
+	return FoldSamplyProfile(profile, syms)
+}
+
+func WriteProfileDiffReport(output io.Writer, diffs []FunctionDiff, top int) error {
+	section := func(title string, items []FunctionDiff) error {
+		if _, err := fmt.Fprintf(output, "%v\n%-10v %-10v %-10v %-10v %v\n", title, "self", "Δself", "total", "Δtotal", "function"); err != nil {
+			return err
+		}
+		for _, item := range items {
+			_, err := fmt.Fprintf(
+				output,
+				"%-10v %-10v %-10v %-10v %v\n",
+				fmt.Sprintf("%.2f%%", 100*item.TargetSelf),
+				fmt.Sprintf("%+.2f%%", 100*item.SelfDelta()),
+				fmt.Sprintf("%.2f%%", 100*item.TargetTotal),
+				fmt.Sprintf("%+.2f%%", 100*(item.TargetTotal-item.BaseTotal)),
+				item.Name,
+			)
+			if err != nil {
+				return err
+			}
+		}
+		_, err := fmt.Fprintln(output)
+		return err
+	}
+	gained := make([]FunctionDiff, 0)
+	for _, diff := range diffs {
+		if len(gained) < top && diff.SelfDelta() > 0 {
+			gained = append(gained, diff)
+		}
+	}
+	lost := make([]FunctionDiff, 0)
+	for i := len(diffs) - 1; i >= 0; i-- {
+		if len(lost) < top && diffs[i].SelfDelta() < 0 {
+			lost = append(lost, diffs[i])
+		}
+	}
+	if err := section("functions which gained time:", gained); err != nil {
+		return err
+	}
+	return section("functions which lost time:", lost)
+}
+
+// CommandProfileDiff compares profiles of the same query from two profiles dbs (or finished benchmarks of two revisions)
+func CommandProfileDiff(storage *Storage, meta string, args []string) error {
+	flags := flag.NewFlagSet("profile-diff", flag.ContinueOnError)
+	var (
+		baseDb         = flags.String("base", "", "profiles db of the base benchmark")
+		targetDb       = flags.String("target", "", "profiles db of the target benchmark")
+		baseRevision   = flags.String("base-revision", "", "revision of the base benchmark (used if -base is not set)")
+		targetRevision = flags.String("target-revision", "", "revision of the target benchmark (used if -target is not set)")
+		dataset        = flags.String("dataset", "", "dataset name")
+		query          = flags.String("query", "", "query name")
+		runner         = flags.String("runner", "turso", "runner name")
+		top            = flags.Int("top", 20, "number of functions in every section of the report")
+		svg            = flags.String("svg", "", "path for the differential flamegraph svg")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *dataset == "" || *query == "" {
+		return fmt.Errorf("dataset and query must be set")
+	}
+	resolve := func(db string, revision string) (string, error) {
+		if db != "" {
+			return db, nil
+		}
+		if revision == "" {
+			return "", fmt.Errorf("either profiles db or revision must be set")
+		}
+		metaDb, err := storage.ConnectDb(meta)
+		if err != nil {
+			return "", err
+		}
+		defer metaDb.Close()
+		benchmark, err := storage.FindBenchmark(metaDb, revision, *dataset)
+		if err != nil {
+			return "", err
+		}
+		return benchmark.Profiles, nil
+	}
+	baseName, err := resolve(*baseDb, *baseRevision)
+	if err != nil {
+		return err
+	}
+	targetName, err := resolve(*targetDb, *targetRevision)
+	if err != nil {
+		return err
+	}
+	base, err := LoadFoldedProfile(storage, baseName, *runner, *dataset, *query)
+	if err != nil {
+		return fmt.Errorf("failed to load base profile: %w", err)
+	}
+	target, err := LoadFoldedProfile(storage, targetName, *runner, *dataset, *query)
+	if err != nil {
+		return fmt.Errorf("failed to load target profile: %w", err)
+	}
+
+	fmt.Printf("profile diff for %v %v/%v: %v -> %v\n\n", *runner, *dataset, *query, baseName, targetName)
+	err = WriteProfileDiffReport(os.Stdout, DiffFunctions(FunctionStats(base), FunctionStats(target)), *top)
+	if err != nil {
+		return err
+	}
+	if *svg != "" {
+		file, err := os.Create(*svg)
+		if err != nil {
+			return err
+		}
+		defer file.Close()
+		title := fmt.Sprintf("%v %v/%v: %v -> %v", *runner, *dataset, *query, baseName, targetName)
+		err = RenderFlamegraph(file, title, DiffFlameTree(base, target), DiffColor)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,45 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfileDiff(t *testing.T) {
+	base := []FoldedStack{
+		{Frames: []string{"tursodb", "main", "step"}, Count: 6},
+		{Frames: []string{"tursodb", "main", "parse"}, Count: 4},
+	}
+	target := []FoldedStack{
+		{Frames: []string{"tursodb", "main", "step"}, Count: 15},
+		{Frames: []string{"tursodb", "main", "parse"}, Count: 4},
+		{Frames: []string{"tursodb", "main", "alloc"}, Count: 1},
+	}
+
+	stats := FunctionStats(base)
+	require.InDelta(t, 0.6, stats["step"].Self, 1e-9)
+	require.InDelta(t, 1.0, stats["main"].Total, 1e-9)
+	require.Equal(t, 0.0, stats["main"].Self)
+
+	diffs := DiffFunctions(stats, FunctionStats(target))
+	require.Equal(t, "step", diffs[0].Name)
+	require.InDelta(t, 0.15, diffs[0].SelfDelta(), 1e-9)
+	require.Equal(t, "parse", diffs[len(diffs)-1].Name)
+	require.InDelta(t, -0.2, diffs[len(diffs)-1].SelfDelta(), 1e-9)
+
+	var report bytes.Buffer
+	require.Nil(t, WriteProfileDiffReport(&report, diffs, 1))
+	require.Contains(t, report.String(), "+15.00%")
+	require.Contains(t, report.String(), "parse")
+	require.NotContains(t, report.String(), "alloc")
+
+	root := DiffFlameTree(base, target)
+	require.Equal(t, 0, root.Delta)
+	main := root.child("tursodb").child("main")
+	require.Equal(t, 3, main.child("step").Delta)
+	require.Equal(t, -4, main.child("parse").Delta)
+	require.Equal(t, 1, main.child("alloc").Delta)
+	require.Equal(t, "rgb(255,0,0)", DiffColor(main.child("alloc")))
+}
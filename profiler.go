@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"os/exec"
+	"runtime"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	ProfilingNone      = "none"
+	ProfilingTursoOnly = "turso-only"
+	ProfilingAll       = "all"
+	// ProfilingRegressed profiles only queries which timing regressed against the baseline benchmark
+	ProfilingRegressed = "only-regressed-queries"
+)
+
+func ValidateProfiling(policy string) error {
+	switch policy {
+	case ProfilingNone, ProfilingTursoOnly, ProfilingAll, ProfilingRegressed:
+		return nil
+	}
+	return fmt.Errorf("unknown profiling policy: %v", policy)
+}
+
+// ShouldProfile tells if the runner must be profiled during the main benchmark pass
+func ShouldProfile(policy string, runner Instance) bool {
+	switch policy {
+	case ProfilingTursoOnly:
+		return EngineName(runner) == "turso"
+	case ProfilingAll:
+		return true
+	}
+	return false
+}
+
+type Profiler interface {
+	Name() string
+	// Profile executes the command under profiler (both are isolated) and returns list of produced files (named with the prefix)
+	Profile(args []string, prefix string, isolation Isolation) ([]string, error)
+}
+
+func NewProfiler(name string) (Profiler, error) {
+	switch name {
+	case "samply":
+		return &ProfilerSamply{}, nil
+	case "perf":
+		return &ProfilerPerf{}, nil
+	case "none", "":
+		return &ProfilerNone{}, nil
+	}
+	return nil, fmt.Errorf("unknown profiler: %v", name)
+}
+
+// ProfilerRule selects profiler for the runner (by name or engine) and dataset; empty or "*" value matches everything
+type ProfilerRule struct {
+	Runner   string
+	Dataset  string
+	Profiler Profiler
+}
+
+// ParseProfilers parses comma-separated list of rules in the format [runner[/dataset]=]profiler,
+// for example "turso=samply,sqlite3/clickhouse=perf,none"; first matching rule wins
+func ParseProfilers(spec string) ([]ProfilerRule, error) {
+	rules := make([]ProfilerRule, 0)
+	for _, item := range strings.Split(spec, ",") {
+		item = strings.TrimSpace(item)
+		if item == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		if !ok {
+			key, value = "*", key
+		}
+		runner, dataset, _ := strings.Cut(key, "/")
+		profiler, err := NewProfiler(value)
+		if err != nil {
+			return nil, err
+		}
+		rules = append(rules, ProfilerRule{Runner: runner, Dataset: dataset, Profiler: profiler})
+	}
+	return rules, nil
+}
+
+func ruleMatches(pattern string, values ...string) bool {
+	return pattern == "" || pattern == "*" || slices.Contains(values, pattern)
+}
+
+func ProfilerFor(rules []ProfilerRule, runner Instance, dataset string) Profiler {
+	for _, rule := range rules {
+		if ruleMatches(rule.Runner, runner.Name(), EngineName(runner)) && ruleMatches(rule.Dataset, dataset) {
+			return rule.Profiler
+		}
+	}
+	return &ProfilerNone{}
+}
+
+// setParanoid allows profiling of the user processes; sudo is used only if the current perf_event_paranoid level
+// is too strict and the check is done once per process
+var setParanoid = sync.OnceValue(func() error {
+	switch runtime.GOOS {
+	case "linux":
+		value, err := readTrimmed("/proc/sys/kernel/perf_event_paranoid")
+		if err != nil {
+			return err
+		}
+		if level, err := strconv.Atoi(value); err == nil && level <= 1 {
+			return nil
+		}
+		Logger.Infof("perf_event_paranoid is %v, set it to 1", value)
+		if err := exec.Command("sh", "-c", "echo '1' | sudo tee /proc/sys/kernel/perf_event_paranoid").Run(); err != nil {
+			return fmt.Errorf("failed to set perf_event_paranoid: %w", err)
+		}
+		return nil
+	case "darwin":
+		return nil
+	}
+	return fmt.Errorf("unable to set paranoid for platform '%v'", runtime.GOOS)
+})
+
+type ProfilerNone struct{}
+
+func (p *ProfilerNone) Name() string                                                { return "none" }
+func (p *ProfilerNone) Profile(_ []string, _ string, _ Isolation) ([]string, error) { return nil, nil }
+
+type ProfilerSamply struct{}
+
+func (p *ProfilerSamply) Name() string { return "samply" }
+func (p *ProfilerSamply) Profile(args []string, prefix string, isolation Isolation) ([]string, error) {
+	profileJson := fmt.Sprintf("%v.json.gz", prefix)
+	profileSym := fmt.Sprintf("%v.json.syms.json", prefix)
+
+	final := make([]string, 0)
+	final = append(final, "samply", "record", "-s", "-o", profileJson, "--unstable-presymbolicate", "--")
+	final = append(final, args...)
+
+	err := setParanoid()
+	if err != nil {
+		return nil, err
+	}
+
+	Logger.Infof("running profile cmd %v", final[:len(final)-1])
+	output, err := isolation.CombinedOutput(exec.Command(final[0], final[1:]...))
+	if err != nil {
+		return nil, fmt.Errorf("profile command failed: err=%w, out=%v", err, string(output))
+	}
+	return []string{profileJson, profileSym}, nil
+}
+
+// ProfilerPerf records profile with perf record and stores perf.data together with folded stacks
+type ProfilerPerf struct{}
+
+func (p *ProfilerPerf) Name() string { return "perf" }
+func (p *ProfilerPerf) Profile(args []string, prefix string, isolation Isolation) ([]string, error) {
+	perfData := fmt.Sprintf("%v.perf.data", prefix)
+	perfFolded := fmt.Sprintf("%v.folded", prefix)
+
+	final := make([]string, 0)
+	final = append(final, "perf", "record", "-g", "-o", perfData, "--")
+	final = append(final, args...)
+
+	err := setParanoid()
+	if err != nil {
+		return nil, err
+	}
+
+	Logger.Infof("running profile cmd %v", final[:len(final)-1])
+	output, err := isolation.CombinedOutput(exec.Command(final[0], final[1:]...))
+	if err != nil {
+		return nil, fmt.Errorf("profile command failed: err=%w, out=%v", err, string(output))
+	}
+
+	script := exec.Command("perf", "script", "-i", perfData)
+	stdout, err := script.StdoutPipe()
+	if err != nil {
+		return nil, err
+	}
+	if err := script.Start(); err != nil {
+		return nil, err
+	}
+	folded, err := os.Create(perfFolded)
+	if err != nil {
+		script.Wait()
+		return nil, err
+	}
+	defer folded.Close()
+	foldErr := FoldPerfScript(stdout, folded)
+	if err := script.Wait(); err != nil {
+		return nil, fmt.Errorf("perf script failed: %w", err)
+	}
+	if foldErr != nil {
+		return nil, foldErr
+	}
+	return []string{perfData, perfFolded}, nil
+}
+
+// FoldPerfScript converts perf script output to the collapsed stacks format (comm;root;...;leaf count)
+func FoldPerfScript(input io.Reader, output io.Writer) error {
+	counts := make(map[string]int, 0)
+	order := make([]string, 0)
+	var comm string
+	var frames []string
+	flush := func() {
+		if comm == "" {
+			return
+		}
+		stack := make([]string, 0, len(frames)+1)
+		stack = append(stack, comm)
+		for i := len(frames) - 1; i >= 0; i-- {
+			stack = append(stack, frames[i])
+		}
+		key := strings.Join(stack, ";")
+		if _, ok := counts[key]; !ok {
+			order = append(order, key)
+		}
+		counts[key]++
+		comm, frames = "", nil
+	}
+	scanner := bufio.NewScanner(input)
+	scanner.Buffer(make([]byte, 0, 64*1024), 16*1024*1024)
+	for scanner.Scan() {
+		line := scanner.Text()
+		if strings.TrimSpace(line) == "" {
+			flush()
+			continue
+		}
+		if line[0] != ' ' && line[0] != '\t' {
+			flush()
+			fields := strings.Fields(line)
+			if len(fields) > 0 {
+				comm = fields[0]
+			}
+			continue
+		}
+		// frame line: <address> <symbol>+<offset> (<module>)
+		fields := strings.Fields(line)
+		if len(fields) < 2 {
+			continue
+		}
+		symbol := strings.Join(fields[1:], " ")
+		if i := strings.LastIndex(symbol, " ("); i >= 0 {
+			symbol = symbol[:i]
+		}
+		if i := strings.LastIndex(symbol, "+0x"); i >= 0 {
+			symbol = symbol[:i]
+		}
+		frames = append(frames, strings.ReplaceAll(symbol, ";", ":"))
+	}
+	flush()
+	if err := scanner.Err(); err != nil {
+		return err
+	}
+	for _, key := range order {
+		if _, err := fmt.Fprintf(output, "%v %v\n", key, counts[key]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestProfilerFor(t *testing.T) {
+	rules, err := ParseProfilers("turso/clickhouse=perf, sqlite3=none, samply")
+	require.Nil(t, err)
+	require.Len(t, rules, 3)
+
+	turso := &InstanceTurso{Variant: "release-native"}
+	require.Equal(t, "perf", ProfilerFor(rules, turso, "clickhouse").Name())
+	require.Equal(t, "samply", ProfilerFor(rules, turso, "tpc-h").Name())
+	require.Equal(t, "none", ProfilerFor(rules, &RunnerSqlite{}, "clickhouse").Name())
+	require.Equal(t, "none", ProfilerFor(nil, turso, "tpc-h").Name())
+
+	_, err = ParseProfilers("turso=valgrind")
+	require.NotNil(t, err)
+}
+
+func TestFoldPerfScript(t *testing.T) {
+	script := strings.Join([]string{
+		"tursodb 100 1.000:     250000 cycles:u: ",
+		"\t    7f01 turso_core::vdbe::step+0x12 (/bin/tursodb)",
+		"\t    7f02 main+0x34 (/bin/tursodb)",
+		"",
+		"tursodb 100 1.001:     250000 cycles:u: ",
+		"\t    7f01 turso_core::vdbe::step+0x20 (/bin/tursodb)",
+		"\t    7f02 main+0x34 (/bin/tursodb)",
+		"",
+		"tursodb 100 1.002:     250000 cycles:u: ",
+		"\t    7f03 [unknown] ([kernel.kallsyms])",
+		"",
+	}, "\n")
+	var output bytes.Buffer
+	require.Nil(t, FoldPerfScript(strings.NewReader(script), &output))
+	require.Equal(t, "tursodb;main;turso_core::vdbe::step 2\ntursodb;[unknown] 1\n", output.String())
+}
+
+func TestShouldProfile(t *testing.T) {
+	turso, sqlite := &InstanceTurso{Variant: "release-native"}, &RunnerSqlite{}
+	require.True(t, ShouldProfile(ProfilingAll, sqlite))
+	require.True(t, ShouldProfile(ProfilingTursoOnly, turso))
+	require.False(t, ShouldProfile(ProfilingTursoOnly, sqlite))
+	require.False(t, ShouldProfile(ProfilingNone, turso))
+	require.False(t, ShouldProfile(ProfilingRegressed, turso))
+	require.NotNil(t, ValidateProfiling("sometimes"))
+}
+
+func TestBaselineSamples(t *testing.T) {
+	baseline := BenchmarkInfo{Revision: "0123456789abcdef"}
+	labeled := &InstanceTurso{Label: "fedcba98"}
+	require.Equal(t, []float64{1}, baselineSamples(map[string][]float64{"turso": {1}}, labeled, baseline))
+	require.Equal(t, []float64{2}, baselineSamples(map[string][]float64{"turso-01234567": {2}}, labeled, baseline))
+	require.Equal(t, []float64{3}, baselineSamples(map[string][]float64{"sqlite3": {3}}, &RunnerSqlite{}, baseline))
+	require.Empty(t, baselineSamples(map[string][]float64{"turso-fedcba98": {4}}, labeled, baseline))
+}
@@ -0,0 +1,369 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"maps"
+	"os"
+	"slices"
+	"strings"
+)
+
+type ReportRunner struct {
+	Runner  string  `json:"runner"`
+	Median  float64 `json:"median"`
+	Samples int     `json:"samples"`
+	// Ratio is the median time relative to the reference runner median
+	Ratio float64 `json:"ratio,omitempty"`
+	// Baseline is the comparison with the same runner of the baseline benchmark
+	Baseline *QueryComparison `json:"baseline,omitempty"`
+	// Missing is set if runner has no measurements for the query (benchmark aborted or runner failed)
+	Missing bool `json:"missing,omitempty"`
+	// Skipped is set if query is not supported by the runner (see Query.Runners and WarningSkipped)
+	Skipped bool `json:"skipped,omitempty"`
+	// Timeout is set if runner exceeded the timeout for the query and has no measurements
+	Timeout bool `json:"timeout,omitempty"`
+}
+
+type ReportQuery struct {
+	Name        string         `json:"name"`
+	Measurement string         `json:"measurement"`
+	Runners     []ReportRunner `json:"runners"`
+	Mismatches  []string       `json:"mismatches,omitempty"`
+	Warnings    []string       `json:"warnings,omitempty"`
+}
+
+type DatasetReport struct {
+	Dataset   string `json:"dataset"`
+	Revision  string `json:"revision"`
+	Results   string `json:"results"`
+	Baseline  string `json:"baseline,omitempty"`
+	Reference string `json:"reference"`
+	// Unfinished is set if the benchmark is not finished yet (or aborted) and some measurements can be missing
+	Unfinished bool          `json:"unfinished,omitempty"`
+	Runners    []string      `json:"runners"`
+	Queries    []ReportQuery `json:"queries"`
+}
+
+type ReportSamples struct {
+	Measurement string
+	Target      map[string][]float64
+	Base        map[string][]float64
+}
+
+// BuildDatasetReport summarizes samples of every query: runners are ordered with the reference runner first
+func BuildDatasetReport(report DatasetReport, queries []string, samples map[string]ReportSamples, warnings []Warning, alpha float64, threshold float64) DatasetReport {
+	runners := make(map[string]bool)
+	for _, query := range samples {
+		for runner := range query.Target {
+			runners[runner] = true
+		}
+	}
+	for _, warning := range warnings {
+		runners[warning.Runner] = true
+	}
+	report.Runners = slices.Sorted(maps.Keys(runners))
+	if i := slices.Index(report.Runners, report.Reference); i > 0 {
+		report.Runners = append([]string{report.Reference}, slices.Delete(report.Runners, i, i+1)...)
+	}
+
+	report.Queries = make([]ReportQuery, 0, len(queries))
+	for _, name := range queries {
+		query := samples[name]
+		entry := ReportQuery{Name: name, Measurement: query.Measurement}
+		skipped, timeouts := make(map[string]bool), make(map[string]bool)
+		for _, warning := range warnings {
+			if warning.Name != name {
+				continue
+			}
+			switch {
+			case strings.HasPrefix(warning.Message, WarningMismatch):
+				entry.Mismatches = append(entry.Mismatches, warning.Runner)
+			case warning.Message == WarningSkipped:
+				skipped[warning.Runner] = true
+			case strings.HasPrefix(warning.Message, WarningTimeout):
+				timeouts[warning.Runner] = true
+			default:
+				entry.Warnings = append(entry.Warnings, fmt.Sprintf("%v: %v", warning.Runner, warning.Message))
+			}
+		}
+		reference := median(query.Target[report.Reference])
+		for _, runner := range report.Runners {
+			values := query.Target[runner]
+			item := ReportRunner{Runner: runner, Median: median(values), Samples: len(values)}
+			switch {
+			case skipped[runner]:
+				item.Skipped = true
+			case len(values) == 0 && timeouts[runner]:
+				item.Timeout = true
+			case len(values) == 0:
+				item.Missing = true
+			}
+			measured := !item.Missing && !item.Skipped && !item.Timeout
+			if measured && runner != report.Reference && reference > 0 && !skipped[report.Reference] {
+				item.Ratio = item.Median / reference
+			}
+			if base := query.Base[runner]; measured && len(base) > 0 {
+				comparison := CompareSamples(base, values, alpha, threshold)
+				comparison.Runner, comparison.Name, comparison.Measurement = runner, name, query.Measurement
+				item.Baseline = &comparison
+			}
+			entry.Runners = append(entry.Runners, item)
+		}
+		report.Queries = append(report.Queries, entry)
+	}
+	return report
+}
+
+// LoadDatasetReport reads measurements of the benchmark (and optional baseline) results dbs; queries without
+// measurements (e.g. every runner exceeded the timeout) are reported if they have warnings
+func LoadDatasetReport(storage *Storage, targetDb *sql.DB, baseDb *sql.DB, report DatasetReport, measurement string, alpha float64, threshold float64) (DatasetReport, error) {
+	written, err := storage.WrittenQueries(targetDb, BenchmarkInfo{}, report.Dataset)
+	if err != nil {
+		return DatasetReport{}, err
+	}
+	warnings, err := storage.Warnings(targetDb, report.Dataset)
+	if err != nil {
+		return DatasetReport{}, err
+	}
+	for _, warning := range warnings {
+		written[warning.Name] = true
+	}
+	queries := make([]string, 0, len(written))
+	samples := make(map[string]ReportSamples, len(written))
+	for _, name := range slices.Sorted(maps.Keys(written)) {
+		if name == BuildName {
+			continue
+		}
+		target, kind, err := QueryMeasurements(storage, targetDb, report.Dataset, name, measurement)
+		if err != nil {
+			return DatasetReport{}, err
+		}
+		var base map[string][]float64
+		if baseDb != nil {
+			base, err = storage.Measurements(baseDb, report.Dataset, name, kind)
+			if err != nil {
+				return DatasetReport{}, err
+			}
+		}
+		queries = append(queries, name)
+		samples[name] = ReportSamples{Measurement: kind, Target: target, Base: base}
+	}
+	return BuildDatasetReport(report, queries, samples, warnings, alpha, threshold), nil
+}
+
+func shortRevision(revision string) string {
+	return revision[0:min(8, len(revision))]
+}
+
+func WriteMarkdownReport(output io.Writer, reports []DatasetReport) error {
+	var builder strings.Builder
+	for _, report := range reports {
+		fmt.Fprintf(&builder, "### %v (`%v`", report.Dataset, shortRevision(report.Revision))
+		if report.Baseline != "" {
+			fmt.Fprintf(&builder, " vs baseline `%v`", shortRevision(report.Baseline))
+		}
+		if report.Unfinished {
+			builder.WriteString(", unfinished")
+		}
+		builder.WriteString(")\n\n")
+
+		header := []string{"query"}
+		for _, runner := range report.Runners {
+			header = append(header, runner)
+		}
+		for _, runner := range report.Runners {
+			if runner != report.Reference {
+				header = append(header, fmt.Sprintf("%v / %v", runner, report.Reference))
+			}
+		}
+		if report.Baseline != "" {
+			for _, runner := range report.Runners {
+				header = append(header, fmt.Sprintf("%v Δ", runner))
+			}
+		}
+		header = append(header, "notes")
+		fmt.Fprintf(&builder, "| %v |\n|%v\n", strings.Join(header, " | "), strings.Repeat("---|", len(header)))
+
+		mismatches, missing, timeouts, regressed := 0, 0, 0, 0
+		for _, query := range report.Queries {
+			row := []string{query.Name}
+			notes := make([]string, 0)
+			for _, runner := range query.Runners {
+				switch {
+				case runner.Missing:
+					row = append(row, "-")
+					notes = append(notes, fmt.Sprintf("missing %v", runner.Runner))
+					missing++
+				case runner.Skipped:
+					row = append(row, "skip")
+				case runner.Timeout:
+					row = append(row, "timeout")
+					timeouts++
+				default:
+					row = append(row, fmt.Sprintf("%.3fs", runner.Median))
+				}
+			}
+			for _, runner := range query.Runners {
+				if runner.Runner == report.Reference {
+					continue
+				}
+				if runner.Ratio == 0 {
+					row = append(row, "-")
+				} else {
+					row = append(row, fmt.Sprintf("%.2fx", runner.Ratio))
+				}
+			}
+			if report.Baseline != "" {
+				for _, runner := range query.Runners {
+					if runner.Baseline == nil || runner.Baseline.Ratio == 0 {
+						row = append(row, "-")
+						continue
+					}
+					delta := fmt.Sprintf("%+.1f%%", 100*(runner.Baseline.Ratio-1))
+					switch runner.Baseline.Verdict {
+					case VerdictRegressed:
+						delta = fmt.Sprintf("**%v**", delta)
+						regressed++
+					case VerdictImproved:
+						delta = fmt.Sprintf("_%v_", delta)
+					}
+					row = append(row, delta)
+				}
+			}
+			if len(query.Mismatches) > 0 {
+				notes = append(notes, fmt.Sprintf("mismatch %v", strings.Join(query.Mismatches, ", ")))
+				mismatches++
+			}
+			if len(query.Warnings) > 0 {
+				notes = append(notes, fmt.Sprintf("%v warnings", len(query.Warnings)))
+			}
+			row = append(row, strings.Join(notes, "; "))
+			fmt.Fprintf(&builder, "| %v |\n", strings.Join(row, " | "))
+		}
+		fmt.Fprintf(&builder, "\n%v queries, %v mismatches, %v timeouts, %v missing measurements", len(report.Queries), mismatches, timeouts, missing)
+		if report.Baseline != "" {
+			fmt.Fprintf(&builder, ", %v significant regressions", regressed)
+		}
+		builder.WriteString("\n\n")
+	}
+	_, err := io.WriteString(output, builder.String())
+	return err
+}
+
+func WriteJsonReport(output io.Writer, reports []DatasetReport) error {
+	encoder := json.NewEncoder(output)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(map[string]any{"datasets": reports})
+}
+
+// CommandReport renders markdown or json report of the latest benchmarks of the revision for every dataset
+// (unfinished benchmarks are reported with the measurements written so far)
+func CommandReport(storage *Storage, meta string, args []string) error {
+	flags := flag.NewFlagSet("report", flag.ContinueOnError)
+	var (
+		revision         = flags.String("revision", "", "revision of the benchmark")
+		datasets         = flags.String("dataset", "", "comma separated list of datasets")
+		baselineRevision = flags.String("baseline-revision", "", "revision of the baseline benchmark")
+		baselineBranch   = flags.String("baseline-branch", "", "use latest finished benchmark of the branch on the same host as a baseline (if -baseline-revision is not set)")
+		reference        = flags.String("reference", "sqlite3", "runner used as a reference for the ratios")
+		measurement      = flags.String("measurement", MeasurementNetTime, "reported measurement (total_time is used for queries without net_time)")
+		alpha            = flags.Float64("alpha", 0.05, "significance level of the Mann-Whitney U test")
+		threshold        = flags.Float64("threshold", 0.05, "minimal relative change of median time considered as a regression or improvement")
+		format           = flags.String("format", "markdown", "report format: markdown or json")
+		path             = flags.String("output", "", "path for the report (stdout if not set)")
+	)
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if *revision == "" || *datasets == "" {
+		return fmt.Errorf("revision and dataset must be set")
+	}
+	write := WriteMarkdownReport
+	switch *format {
+	case "markdown":
+	case "json":
+		write = WriteJsonReport
+	default:
+		return fmt.Errorf("unknown report format: %v", *format)
+	}
+
+	metaDb, err := storage.ConnectDb(meta)
+	if err != nil {
+		return err
+	}
+	defer metaDb.Close()
+
+	// load builds report of the dataset; it is a separate function so results dbs are closed right after the dataset is loaded
+	load := func(dataset string) (DatasetReport, error) {
+		benchmark, finished, err := storage.LatestBenchmark(metaDb, *revision, dataset)
+		if err != nil {
+			return DatasetReport{}, err
+		}
+		targetDb, err := storage.ConnectDb(benchmark.Results)
+		if err != nil {
+			return DatasetReport{}, err
+		}
+		defer targetDb.Close()
+
+		var baseline BenchmarkInfo
+		if *baselineRevision != "" {
+			baseline, err = storage.FindBenchmark(metaDb, *baselineRevision, dataset)
+		} else if *baselineBranch != "" {
+			parameters, paramsErr := storage.Parameters(targetDb)
+			if paramsErr != nil {
+				return DatasetReport{}, paramsErr
+			}
+			baseline, err = FindComparableBaseline(storage, metaDb, benchmark, parameters, *baselineBranch)
+		}
+		if err != nil {
+			return DatasetReport{}, err
+		}
+		var baseDb *sql.DB
+		if baseline.Results != "" {
+			baseDb, err = storage.ConnectDb(baseline.Results)
+			if err != nil {
+				return DatasetReport{}, err
+			}
+			defer baseDb.Close()
+		}
+
+		report, err := LoadDatasetReport(storage, targetDb, baseDb, DatasetReport{
+			Dataset:    dataset,
+			Revision:   benchmark.Revision,
+			Results:    benchmark.Results,
+			Baseline:   baseline.Revision,
+			Reference:  *reference,
+			Unfinished: !finished,
+		}, *measurement, *alpha, *threshold)
+		if err != nil {
+			return DatasetReport{}, fmt.Errorf("failed to build report for %v: %w", benchmark, err)
+		}
+		return report, nil
+	}
+
+	reports := make([]DatasetReport, 0)
+	for _, dataset := range strings.FieldsFunc(*datasets, func(r rune) bool { return r == ',' }) {
+		report, err := load(dataset)
+		if err != nil {
+			return err
+		}
+		reports = append(reports, report)
+	}
+
+	if *path == "" {
+		return write(os.Stdout, reports)
+	}
+	file, err := os.Create(*path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	if err := write(file, reports); err != nil {
+		return err
+	}
+	return file.Close()
+}
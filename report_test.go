@@ -0,0 +1,76 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestReport(t *testing.T) {
+	samples := map[string]ReportSamples{
+		"q1": {
+			Measurement: MeasurementNetTime,
+			Target:      map[string][]float64{"turso": {2.0, 2.1, 1.9, 2.0, 2.0}, "sqlite3": {1.0, 1.0, 1.0, 1.0, 1.0}},
+			Base:        map[string][]float64{"turso": {1.5, 1.5, 1.5, 1.5, 1.5}, "sqlite3": {1.0, 1.0, 1.0, 1.0, 1.0}},
+		},
+		"q2": {
+			Measurement: MeasurementNetTime,
+			Target:      map[string][]float64{"turso": {0, 0, 0, 0, 0}, "sqlite3": {1.0, 1.0, 1.0, 1.0, 1.0}},
+		},
+		"q3": {
+			Measurement: MeasurementNetTime,
+			Target:      map[string][]float64{"sqlite3": {1.0}},
+		},
+		"q4": {
+			Measurement: MeasurementNetTime,
+			Target:      map[string][]float64{"sqlite3": {1.0}},
+		},
+	}
+	warnings := []Warning{
+		{Runner: "turso", Name: "q1", Message: "results mismatch for runners sqlite3 and turso: [1] != [2]"},
+		{Runner: "turso", Name: "q1", Message: "samply profiler failed"},
+		{Runner: "turso", Name: "q2", Message: WarningSkipped},
+		{Runner: "turso", Name: "q4", Message: (&TimeoutError{Timeout: time.Minute}).Error()},
+	}
+	report := BuildDatasetReport(
+		DatasetReport{Dataset: "tpch", Revision: "0123456789", Baseline: "abcdef0123", Reference: "sqlite3"},
+		[]string{"q1", "q2", "q3", "q4"},
+		samples,
+		warnings,
+		0.05,
+		0.05,
+	)
+	require.Equal(t, []string{"sqlite3", "turso"}, report.Runners)
+	require.Len(t, report.Queries, 4)
+
+	q1 := report.Queries[0]
+	require.Equal(t, []string{"turso"}, q1.Mismatches)
+	require.Equal(t, []string{"turso: samply profiler failed"}, q1.Warnings)
+	require.InDelta(t, 2.0, q1.Runners[1].Ratio, 1e-9)
+	require.Equal(t, VerdictRegressed, q1.Runners[1].Baseline.Verdict)
+	require.Equal(t, VerdictUnchanged, q1.Runners[0].Baseline.Verdict)
+	require.True(t, report.Queries[1].Runners[1].Skipped)
+	require.True(t, report.Queries[2].Runners[1].Missing)
+	require.True(t, report.Queries[3].Runners[1].Timeout)
+	require.Empty(t, report.Queries[3].Warnings)
+
+	var markdown bytes.Buffer
+	require.Nil(t, WriteMarkdownReport(&markdown, []DatasetReport{report}))
+	require.Equal(t, "### tpch (`01234567` vs baseline `abcdef01`)\n\n"+
+		"| query | sqlite3 | turso | turso / sqlite3 | sqlite3 Δ | turso Δ | notes |\n"+
+		"|---|---|---|---|---|---|---|\n"+
+		"| q1 | 1.000s | 2.000s | 2.00x | +0.0% | **+33.3%** | mismatch turso; 1 warnings |\n"+
+		"| q2 | 1.000s | skip | - | - | - |  |\n"+
+		"| q3 | 1.000s | - | - | - | - | missing turso |\n"+
+		"| q4 | 1.000s | timeout | - | - | - |  |\n"+
+		"\n4 queries, 1 mismatches, 1 timeouts, 1 missing measurements, 1 significant regressions\n\n", markdown.String())
+
+	var encoded bytes.Buffer
+	require.Nil(t, WriteJsonReport(&encoded, []DatasetReport{report}))
+	var decoded struct{ Datasets []DatasetReport }
+	require.Nil(t, json.Unmarshal(encoded.Bytes(), &decoded))
+	require.Equal(t, report.Queries[0].Runners[1].Ratio, decoded.Datasets[0].Queries[0].Runners[1].Ratio)
+}
@@ -0,0 +1,53 @@
+package main
+
+import (
+	"fmt"
+	"os/exec"
+	"strings"
+)
+
+// RunnerDuckdb executes queries with duckdb CLI over the same SQLite dataset file attached through the duckdb sqlite extension
+type RunnerDuckdb struct {
+	Binary string
+}
+
+type InstanceDuckdb struct {
+	Binary string
+}
+
+func (r *RunnerDuckdb) Name() string { return "duckdb" }
+func (r *RunnerDuckdb) Init(_ BenchmarkInfo) (Instance, error) {
+	return &InstanceDuckdb{Binary: r.Binary}, nil
+}
+
+func (r *InstanceDuckdb) Name() string { return "duckdb" }
+func (r *InstanceDuckdb) RunCmd(path string, query string) []string {
+	attach := fmt.Sprintf("ATTACH '%v' AS dataset (TYPE sqlite, READ_ONLY); USE dataset;", strings.ReplaceAll(path, "'", "''"))
+	return []string{r.Binary, "-list", "-noheader", "-nullvalue", "", "-c", attach + "\n" + query}
+}
+
+func (r *InstanceDuckdb) Parameters() (map[string]any, error) {
+	output, err := exec.Command(r.Binary, "--version").Output()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"duckdb.binary": r.Binary, "duckdb.version": strings.TrimSpace(string(output))}, nil
+}
+
+// Normalize converts duckdb list output to the representation used by sqlite3 CLI
+func (r *InstanceDuckdb) Normalize(lines []string) []string {
+	normalized := make([]string, 0, len(lines))
+	for _, line := range lines {
+		fields := strings.Split(strings.TrimRight(line, " \r"), "|")
+		for i, field := range fields {
+			switch field {
+			case "true":
+				fields[i] = "1"
+			case "false":
+				fields[i] = "0"
+			}
+		}
+		normalized = append(normalized, strings.Join(fields, "|"))
+	}
+	return normalized
+}
@@ -1,5 +1,10 @@
 package main
 
+import (
+	"os/exec"
+	"strings"
+)
+
 type RunnerSqlite struct{}
 
 func (r *RunnerSqlite) Name() string                           { return "sqlite3" }
@@ -7,3 +12,10 @@ func (r *RunnerSqlite) Init(_ BenchmarkInfo) (Instance, error) { return &RunnerS
 func (r *RunnerSqlite) RunCmd(path string, query string) []string {
 	return []string{"sqlite3", path, query}
 }
+func (r *RunnerSqlite) Parameters() (map[string]any, error) {
+	output, err := exec.Command("sqlite3", "--version").Output()
+	if err != nil {
+		return nil, err
+	}
+	return map[string]any{"sqlite3.version": strings.TrimSpace(string(output))}, nil
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RunnerSqliteBuild compiles sqlite3 CLI of the pinned Version from the amalgamation tarball
+// (sqlite-autoconf-XXXYYZZ.tar.gz) which is downloaded from sqlite.org to the Path directory if it is not there yet
+type RunnerSqliteBuild struct {
+	Path     string
+	Version  string
+	Compiler string
+	Options  []string
+}
+
+type InstanceSqliteBuild struct {
+	Path    string
+	Version string
+	Options []string
+	// Compiler is the resolved path of the compiler and CompilerVersion is the first line of its --version output
+	Compiler        string
+	CompilerVersion string
+}
+
+func (r *RunnerSqliteBuild) Name() string { return fmt.Sprintf("sqlite3-%v", r.Version) }
+func (r *RunnerSqliteBuild) Init(_ BenchmarkInfo) (Instance, error) {
+	number, err := sqliteVersionNumber(r.Version)
+	if err != nil {
+		return nil, err
+	}
+	compiler := r.Compiler
+	if compiler == "" {
+		compiler = "cc"
+	}
+	compiler, err = exec.LookPath(compiler)
+	if err != nil {
+		return nil, fmt.Errorf("failed to find sqlite compiler: %w", err)
+	}
+	compilerVersion, err := CompilerVersion(compiler)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha256.Sum256([]byte(compiler + " " + compilerVersion + " " + strings.Join(r.Options, " ")))
+	instance := &InstanceSqliteBuild{
+		Path:            path.Join(r.Path, fmt.Sprintf("benchmark-sqlite-%v-%v", r.Version, hex.EncodeToString(hash[:4]))),
+		Version:         r.Version,
+		Options:         r.Options,
+		Compiler:        compiler,
+		CompilerVersion: compilerVersion,
+	}
+	archive, err := DownloadSqliteAmalgamation(r.Path, number, time.Now().Year())
+	if err != nil {
+		return nil, err
+	}
+	err = UnpackTarGz(archive, instance.Path)
+	if err != nil {
+		return nil, err
+	}
+	err = BuildSqlite(instance.Path, compiler, r.Options)
+	if err != nil {
+		return nil, err
+	}
+	output, err := exec.Command(instance.bin(), ":memory:", "SELECT sqlite_version()").Output()
+	if err != nil {
+		return nil, fmt.Errorf("failed to check sqlite version: %w", err)
+	}
+	if version := strings.TrimSpace(string(output)); version != r.Version {
+		return nil, fmt.Errorf("unexpected sqlite version: %v != %v", version, r.Version)
+	}
+	return instance, nil
+}
+
+func (r *InstanceSqliteBuild) bin() string { return path.Join(r.Path, "sqlite3") }
+
+func (r *InstanceSqliteBuild) Name() string   { return fmt.Sprintf("sqlite3-%v", r.Version) }
+func (r *InstanceSqliteBuild) Engine() string { return "sqlite3" }
+func (r *InstanceSqliteBuild) RunCmd(path string, query string) []string {
+	return []string{r.bin(), path, query}
+}
+func (r *InstanceSqliteBuild) Parameters() (map[string]any, error) {
+	return map[string]any{
+		r.Name() + ".version":          r.Version,
+		r.Name() + ".options":          strings.Join(r.Options, " "),
+		r.Name() + ".compiler":         r.Compiler,
+		r.Name() + ".compiler_version": r.CompilerVersion,
+	}, nil
+}
+
+// CompilerVersion returns the first line of the compiler --version output (e.g. "gcc (Debian 12.2.0-14) 12.2.0")
+func CompilerVersion(compiler string) (string, error) {
+	output, err := exec.Command(compiler, "--version").Output()
+	if err != nil {
+		return "", fmt.Errorf("failed to check compiler version: %w", err)
+	}
+	line, _, _ := strings.Cut(strings.TrimSpace(string(output)), "\n")
+	return strings.TrimSpace(line), nil
+}
+
+// sqliteVersionNumber converts version string (3.46.1) to the number used in the amalgamation archive names (3460100)
+func sqliteVersionNumber(version string) (int, error) {
+	parts := strings.Split(version, ".")
+	if len(parts) < 2 || len(parts) > 4 {
+		return 0, fmt.Errorf("invalid sqlite version: %v", version)
+	}
+	number := 0
+	for i, multiplier := range []int{1000000, 10000, 100, 1} {
+		if i >= len(parts) {
+			break
+		}
+		value, err := strconv.Atoi(parts[i])
+		if err != nil {
+			return 0, fmt.Errorf("invalid sqlite version %v: %w", version, err)
+		}
+		number += value * multiplier
+	}
+	return number, nil
+}
+
+// sqliteFirstAutoconfYear is the first year of sqlite.org/YEAR/ download directories with autoconf amalgamations
+const sqliteFirstAutoconfYear = 2013
+
+var sqliteDownloadUrl = "https://www.sqlite.org"
+
+// DownloadSqliteAmalgamation returns path to the amalgamation tarball of the version number in the dir; it is downloaded
+// if missing and, as sqlite.org keeps tarballs in the directory of the release year, years are probed from the latest
+func DownloadSqliteAmalgamation(dir string, number int, latestYear int) (string, error) {
+	name := fmt.Sprintf("sqlite-autoconf-%v.tar.gz", number)
+	archive := path.Join(dir, name)
+	if _, err := os.Stat(archive); err == nil {
+		return archive, nil
+	} else if !os.IsNotExist(err) {
+		return "", err
+	}
+	for year := latestYear; year >= sqliteFirstAutoconfYear; year-- {
+		url := fmt.Sprintf("%v/%v/%v", sqliteDownloadUrl, year, name)
+		err := DefaultDownloader.Download(url, archive, ValidateGzip)
+		var status *StatusError
+		if errors.As(err, &status) && status.Status == http.StatusNotFound {
+			continue
+		}
+		if err != nil {
+			return "", fmt.Errorf("failed to download sqlite amalgamation %v: %w", name, err)
+		}
+		return archive, nil
+	}
+	return "", fmt.Errorf("sqlite amalgamation %v not found at sqlite.org, place it in %v manually", name, dir)
+}
+
+func UnpackTarGz(filename string, target string) error {
+	Logger.Infof("unpack archive from %v to %v", filename, target)
+	if _, err := os.Stat(target); err == nil {
+		Logger.Infof("directory %v already exists", target)
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	gz, err := gzip.NewReader(file)
+	if err != nil {
+		return err
+	}
+	tmp, err := os.MkdirTemp(filepath.Dir(target), filepath.Base(target)+"-tmp")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(tmp)
+
+	archive := tar.NewReader(gz)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return err
+		}
+		if header.Typeflag != tar.TypeReg {
+			continue
+		}
+		// strip archive root directory
+		name := filepath.Clean(header.Name)
+		if i := strings.IndexByte(name, filepath.Separator); i >= 0 {
+			name = name[i+1:]
+		}
+		if name == "" || !filepath.IsLocal(name) {
+			return fmt.Errorf("invalid archive entry: %v", header.Name)
+		}
+		destination := filepath.Join(tmp, name)
+		if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+			return err
+		}
+		out, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, header.FileInfo().Mode().Perm())
+		if err != nil {
+			return err
+		}
+		_, err = io.Copy(out, archive)
+		out.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+// BuildSqlite compiles sqlite3 CLI in the target dir; the binary is written under the temporary name and renamed when
+// the build succeeds so interrupted builds never leave partial binary behind
+func BuildSqlite(target string, compiler string, options []string) error {
+	Logger.Infof("build sqlite at %v with options %v", target, options)
+	if _, err := os.Stat(path.Join(target, "sqlite3")); err == nil {
+		Logger.Infof("sqlite binary already exists")
+		return nil
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	args := make([]string, 0)
+	args = append(args, options...)
+	args = append(args, "-I.", "shell.c", "sqlite3.c", "-o", "sqlite3-tmp", "-lpthread", "-ldl", "-lm")
+	defer os.Remove(path.Join(target, "sqlite3-tmp"))
+	cmd := exec.Command(compiler, args...)
+	cmd.Dir = target
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("failed to build sqlite: err=%w, out=%v", err, string(output))
+	}
+	return os.Rename(path.Join(target, "sqlite3-tmp"), path.Join(target, "sqlite3"))
+}
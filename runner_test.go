@@ -1,8 +1,226 @@
 package main
 
-import "testing"
+import (
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
 
 func TestTursoRunner(t *testing.T) {
 	turso := RunnerTurso{Profile: "release"}
 	t.Log(turso.Init(BenchmarkInfo{Repo: "tursodatabase/turso", Revision: "main"}))
 }
+
+func TestParseTursoBuilds(t *testing.T) {
+	builds, err := ParseTursoBuilds(`[{"profile":"release"},{"variant":"native","profile":"release","rustflags":"-C target-cpu=native"}]`)
+	require.Nil(t, err)
+	require.Equal(t, []TursoBuild{{Profile: "release"}, {Variant: "native", Profile: "release", RustFlags: "-C target-cpu=native"}}, builds)
+
+	_, err = ParseTursoBuilds(`[{"profile":"release"},{"profile":"dev"}]`)
+	require.ErrorContains(t, err, "duplicate turso build turso")
+	_, err = ParseTursoBuilds(`[{"variant":"native"}]`)
+	require.ErrorContains(t, err, "no profile")
+}
+
+func TestDuckdbNormalize(t *testing.T) {
+	duckdb := InstanceDuckdb{Binary: "duckdb"}
+	require.Equal(t, []string{"1|a|0", "2||1", ""}, duckdb.Normalize([]string{"1|a|false ", "2||true", ""}))
+}
+
+func TestNormalizeNumbers(t *testing.T) {
+	require.Equal(t,
+		[]string{"2|0.3|a|12345678901234567|1.23456789012e+20|", "nan|inf|1e-05"},
+		NormalizeNumbers([]string{"2.0|0.30000000000000004|a|12345678901234567|123456789012345678901|", "nan|inf|1.0e-5"}),
+	)
+	require.Equal(t, NormalizeNumbers([]string{"1.50|-0.0"}), NormalizeNumbers([]string{"1.5|-0"}))
+}
+
+func TestSqliteVersionNumber(t *testing.T) {
+	number, err := sqliteVersionNumber("3.46.1")
+	require.Nil(t, err)
+	require.Equal(t, 3460100, number)
+
+	number, err = sqliteVersionNumber("3.50")
+	require.Nil(t, err)
+	require.Equal(t, 3500000, number)
+
+	_, err = sqliteVersionNumber("latest")
+	require.NotNil(t, err)
+}
+
+func TestCompilerVersion(t *testing.T) {
+	compiler := path.Join(t.TempDir(), "cc")
+	require.Nil(t, os.WriteFile(compiler, []byte("#!/bin/sh\necho 'cc (Debian 12.2.0-14) 12.2.0'\necho 'Copyright (C) 2022'\n"), 0o755))
+	version, err := CompilerVersion(compiler)
+	require.Nil(t, err)
+	require.Equal(t, "cc (Debian 12.2.0-14) 12.2.0", version)
+}
+
+func TestDownloadSqliteAmalgamation(t *testing.T) {
+	var buffer bytes.Buffer
+	gz := gzip.NewWriter(&buffer)
+	_, err := gz.Write([]byte("sqlite"))
+	require.Nil(t, err)
+	require.Nil(t, gz.Close())
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/2024/sqlite-autoconf-3460100.tar.gz" {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		w.Write(buffer.Bytes())
+	}))
+	defer server.Close()
+	previous := sqliteDownloadUrl
+	sqliteDownloadUrl = server.URL
+	defer func() { sqliteDownloadUrl = previous }()
+
+	dir := t.TempDir()
+	archive, err := DownloadSqliteAmalgamation(dir, 3460100, 2026)
+	require.Nil(t, err)
+	require.Equal(t, path.Join(dir, "sqlite-autoconf-3460100.tar.gz"), archive)
+	require.Nil(t, ValidateGzip(archive))
+
+	_, err = DownloadSqliteAmalgamation(dir, 3500000, 2026)
+	require.ErrorContains(t, err, "not found at sqlite.org")
+}
+
+func TestTursoLocalTree(t *testing.T) {
+	repo := t.TempDir()
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"-c", "user.name=test", "-c", "user.email=test@test", "commit", "-q", "--allow-empty", "-m", "init"},
+	} {
+		_, err := git(repo, nil, args...)
+		require.Nil(t, err)
+	}
+	require.Nil(t, os.WriteFile(path.Join(repo, "a.txt"), []byte("a"), 0o644))
+	_, err := git(repo, nil, "add", "a.txt")
+	require.Nil(t, err)
+	_, err = git(repo, nil, "-c", "user.name=test", "-c", "user.email=test@test", "commit", "-q", "-m", "a")
+	require.Nil(t, err)
+
+	head, err := LocalTree(repo, "HEAD")
+	require.Nil(t, err)
+	clean, err := LocalTree(repo, RevisionWorkingTree)
+	require.Nil(t, err)
+	require.Equal(t, head, clean)
+
+	require.Nil(t, os.WriteFile(path.Join(repo, "b.txt"), []byte("b"), 0o644))
+	dirty, err := LocalTree(repo, RevisionWorkingTree)
+	require.Nil(t, err)
+	require.NotEqual(t, head, dirty)
+
+	status, err := git(repo, nil, "status", "--porcelain")
+	require.Nil(t, err)
+	require.Equal(t, "?? b.txt", status)
+}
+
+func TestTursoLocalTreeWithoutIndex(t *testing.T) {
+	repo := t.TempDir()
+	_, err := git(repo, nil, "init", "-q")
+	require.Nil(t, err)
+	require.Nil(t, os.WriteFile(path.Join(repo, "a.txt"), []byte("a"), 0o644))
+	tree, err := LocalTree(repo, RevisionWorkingTree)
+	require.Nil(t, err)
+	require.NotEmpty(t, tree)
+
+	archive := path.Join(t.TempDir(), "turso.zip")
+	require.Nil(t, ArchiveLocalTree(repo, tree, archive))
+	require.Nil(t, ValidateZip(archive))
+	entries, err := os.ReadDir(path.Dir(archive))
+	require.Nil(t, err)
+	require.Len(t, entries, 1)
+}
+
+func writeTestZip(t *testing.T, filename string, entries map[string]string, links map[string]string) {
+	file, err := os.Create(filename)
+	require.Nil(t, err)
+	defer file.Close()
+	archive := zip.NewWriter(file)
+	for name, content := range entries {
+		w, err := archive.Create(name)
+		require.Nil(t, err)
+		_, err = w.Write([]byte(content))
+		require.Nil(t, err)
+	}
+	for name, target := range links {
+		header := &zip.FileHeader{Name: name}
+		header.SetMode(os.ModeSymlink | 0o777)
+		w, err := archive.CreateHeader(header)
+		require.Nil(t, err)
+		_, err = w.Write([]byte(target))
+		require.Nil(t, err)
+	}
+	require.Nil(t, archive.Close())
+}
+
+func TestUnpackRepo(t *testing.T) {
+	dir := t.TempDir()
+
+	archive := path.Join(dir, "repo.zip")
+	writeTestZip(t, archive, map[string]string{
+		"turso-abc/Cargo.toml":     "[workspace]",
+		"turso-abc/cli/src/lib.rs": "fn main() {}",
+	}, map[string]string{"turso-abc/cli/Cargo.toml": "../Cargo.toml"})
+	require.Nil(t, UnpackRepo(archive, path.Join(dir, "repo")))
+	data, err := os.ReadFile(path.Join(dir, "repo", "cli", "src", "lib.rs"))
+	require.Nil(t, err)
+	require.Equal(t, "fn main() {}", string(data))
+	data, err = os.ReadFile(path.Join(dir, "repo", "cli", "Cargo.toml"))
+	require.Nil(t, err)
+	require.Equal(t, "[workspace]", string(data))
+
+	slip := path.Join(dir, "slip.zip")
+	writeTestZip(t, slip, map[string]string{"../evil.txt": "evil"}, nil)
+	require.NotNil(t, UnpackRepo(slip, path.Join(dir, "slip")))
+
+	link := path.Join(dir, "link.zip")
+	writeTestZip(t, link, map[string]string{"root/a.txt": "a"}, map[string]string{"root/passwd": "../../etc/passwd"})
+	require.NotNil(t, UnpackRepo(link, path.Join(dir, "link")))
+
+	// every link is local lexically but d/l2 resolves through d/l outside of the tree
+	chain := path.Join(dir, "chain.zip")
+	writeTestZip(t, chain, map[string]string{"root/d/a.txt": "a"}, map[string]string{"root/d/l": "..", "root/d/l2": "l/.."})
+	require.ErrorContains(t, UnpackRepo(chain, path.Join(dir, "chain")), "passes through another symlink")
+
+	entries, err := os.ReadDir(dir)
+	require.Nil(t, err)
+	names := make([]string, 0)
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	require.ElementsMatch(t, []string{"repo.zip", "repo", "slip.zip", "link.zip", "chain.zip"}, names)
+}
+
+func TestTursoCachedBuildResults(t *testing.T) {
+	cache := &BuildCache{Path: t.TempDir()}
+	instance := &InstanceTurso{Path: cache.Path, Key: "a", Profile: "release"}
+	binary := path.Join(cache.Path, "tursodb")
+	require.Nil(t, os.WriteFile(binary, make([]byte, 10), 0o755))
+	require.Nil(t, os.WriteFile(instance.buildLog(), []byte("log"), 0o644))
+	var err error
+	instance.Binary, err = cache.Store(instance.buildKey(), "tursodb", binary)
+	require.Nil(t, err)
+	require.Nil(t, instance.storeBuild(cache))
+
+	// binary taken from the cache has no build time sample
+	cached := &InstanceTurso{Path: cache.Path, Key: "a", Profile: "release", Binary: instance.Binary}
+	require.Nil(t, cached.loadBuild(cache))
+	results, profiles := BuildResults(BenchmarkInfo{Dataset: "tpc-h"}, []Instance{cached})
+	require.Equal(t, []BenchmarkResult{{
+		Runner:      "turso",
+		Dataset:     "tpc-h",
+		Name:        BuildName,
+		Measurement: MeasurementBinarySize,
+		TotalTime:   10,
+		Attempts:    1,
+	}}, results)
+	require.Len(t, profiles, 1)
+}
@@ -1,150 +1,526 @@
 package main
 
 import (
+	"archive/zip"
 	"fmt"
 	"io"
-	"net/http"
 	"os"
 	"os/exec"
 	"path"
+	"path/filepath"
+	"slices"
+	"strings"
+	"time"
 )
 
+// RevisionWorkingTree can be used as a benchmark revision in order to build turso from
+// the current (possibly dirty) state of the local checkout
+const RevisionWorkingTree = "worktree"
+
 type RunnerTurso struct {
 	Path    string
 	Profile string
+	// Variant is appended to the runner name in order to distinguish different build configurations (e.g. release-native)
+	Variant   string
+	Features  []string
+	RustFlags string
+	// Allocator is an optional cargo feature of turso_cli which selects global allocator (e.g. mimalloc)
+	Allocator string
+	// Local is an optional path to the local turso git checkout used instead of GitHub archives
+	Local string
+	// CacheLimit is the size limit in bytes for archives, source trees and binaries kept in the Path (zero means no limit)
+	CacheLimit int64
+	// CleanBuild builds every revision from the empty target dir without compiler cache in order to record build time;
+	// by default revisions are built incrementally in the shared target dir (with sccache if available) and build time
+	// is not recorded as it depends on the previously built revisions
+	CleanBuild bool
 }
 
 type InstanceTurso struct {
-	Path     string
-	Repo     string
-	Profile  string
-	Revision string
+	Path      string
+	Repo      string
+	Profile   string
+	Variant   string
+	Features  []string
+	RustFlags string
+	Revision  string
+	// Key identifies source tree in the build cache: revision for GitHub archives and tree hash for local checkout
+	Key string
+	// Label distinguishes instances of different revisions benchmarked together
+	Label  string
+	Binary string
+	build  BuildInfo
+}
+
+// BuildError keeps path to the build log of the failed build
+type BuildError struct {
+	Log string
+	Err error
 }
 
+func (e *BuildError) Error() string { return fmt.Sprintf("build failed (log at %v): %v", e.Log, e.Err) }
+func (e *BuildError) Unwrap() error { return e.Err }
+
 func (r *InstanceTurso) archive() string {
-	return path.Join(r.Path, fmt.Sprintf("benchmark-turso-%v.zip", r.Revision))
+	return path.Join(r.Path, fmt.Sprintf("benchmark-turso-%v.zip", r.Key))
 }
 func (r *InstanceTurso) dir() string {
-	return path.Join(r.Path, fmt.Sprintf("benchmark-turso-%v", r.Revision))
+	return path.Join(r.Path, fmt.Sprintf("benchmark-turso-%v", r.Key))
+}
+func (r *InstanceTurso) buildLog() string {
+	return path.Join(r.Path, fmt.Sprintf("benchmark-turso-%v-%v.log", r.Key, r.buildKey()))
 }
 func (r *InstanceTurso) bin() string {
-	return path.Join(r.dir(), "target", r.Profile, "tursodb")
+	return r.Binary
+}
+func (r *InstanceTurso) buildKey() string {
+	return CacheKey(r.Key, r.Profile, strings.Join(r.Features, ","), r.RustFlags)
 }
 
-func (r *RunnerTurso) Name() string { return "turso" }
+func (r *RunnerTurso) Name() string {
+	if r.Variant != "" {
+		return fmt.Sprintf("turso-%v", r.Variant)
+	}
+	return "turso"
+}
 func (r *RunnerTurso) Init(benchmark BenchmarkInfo) (Instance, error) {
+	cache := &BuildCache{Path: r.Path, Limit: r.CacheLimit}
+	features := slices.Clone(r.Features)
+	if r.Allocator != "" {
+		features = append(features, r.Allocator)
+	}
 	instance := &InstanceTurso{
-		Path:     r.Path,
-		Repo:     benchmark.Repo,
-		Profile:  r.Profile,
-		Revision: benchmark.Revision,
+		Path:      r.Path,
+		Repo:      benchmark.Repo,
+		Profile:   r.Profile,
+		Variant:   r.Variant,
+		Features:  features,
+		RustFlags: r.RustFlags,
+		Revision:  benchmark.Revision,
+		Key:       benchmark.Revision,
+	}
+	if len(benchmark.Compare) > 0 {
+		instance.Label = benchmark.Revision[0:min(8, len(benchmark.Revision))]
+	}
+	var tree string
+	if r.Local != "" {
+		var err error
+		tree, err = LocalTree(r.Local, benchmark.Revision)
+		if err != nil {
+			return nil, err
+		}
+		instance.Repo = r.Local
+		instance.Key = fmt.Sprintf("tree-%v", tree)
+	}
+	if binary, ok := cache.Lookup(instance.buildKey(), "tursodb"); ok {
+		Logger.Infof("found cached turso binary %v for %v", binary, instance.Key)
+		instance.Binary = binary
+		err := instance.loadBuild(cache)
+		if err != nil {
+			return nil, err
+		}
+		return instance, nil
+	}
+
+	if r.Local != "" {
+		err := ArchiveLocalTree(r.Local, tree, instance.archive())
+		if err != nil {
+			return nil, err
+		}
+	} else {
+		err := DownloadRepo(benchmark.Repo, instance.Revision, instance.archive())
+		if err != nil {
+			return nil, err
+		}
 	}
-	err := DownloadRepo(benchmark.Repo, instance.Revision, instance.archive())
+	err := UnpackRepo(instance.archive(), instance.dir())
 	if err != nil {
 		return nil, err
 	}
-	err = UnpackRepo(instance.archive(), instance.dir())
+	cache.Touch(instance.archive(), instance.dir())
+	log, err := os.Create(instance.buildLog())
 	if err != nil {
 		return nil, err
 	}
-	err = BuildTurso(instance.dir(), r.Profile)
+	defer log.Close()
+	targetDir := cache.TargetDir()
+	if r.CleanBuild {
+		targetDir = path.Join(cache.TargetDir(), "clean-"+instance.buildKey())
+		if err := os.RemoveAll(targetDir); err != nil {
+			return nil, err
+		}
+		defer os.RemoveAll(targetDir)
+	}
+	start := time.Now()
+	binary, err := BuildTurso(instance.dir(), targetDir, r.Profile, features, r.RustFlags, !r.CleanBuild, log)
+	if err != nil {
+		return nil, &BuildError{Log: instance.buildLog(), Err: err}
+	}
+	duration := time.Since(start)
+	cache.Touch(cache.TargetDir())
+	instance.Binary, err = cache.Store(instance.buildKey(), "tursodb", binary)
 	if err != nil {
 		return nil, err
 	}
-
+	err = instance.storeBuild(cache)
+	if err != nil {
+		return nil, err
+	}
+	if r.CleanBuild {
+		instance.build.Duration = duration.Seconds()
+	}
 	return instance, nil
 }
 
-func (r *InstanceTurso) Name() string { return "turso" }
+// Collect evicts least recently used cache entries except the archives, source trees and binaries of the instances
+func (r *RunnerTurso) Collect(instances []Instance) error {
+	keep := make([]string, 0)
+	for _, instance := range instances {
+		if turso, ok := instance.(*InstanceTurso); ok && turso.Path == r.Path {
+			keep = append(keep, turso.archive(), turso.dir(), path.Dir(turso.Binary))
+		}
+	}
+	cache := &BuildCache{Path: r.Path, Limit: r.CacheLimit}
+	return cache.Collect(keep...)
+}
+
+func (r *InstanceTurso) Name() string {
+	name := "turso"
+	if r.Variant != "" {
+		name = fmt.Sprintf("%v-%v", name, r.Variant)
+	}
+	if r.Label != "" {
+		name = fmt.Sprintf("%v-%v", name, r.Label)
+	}
+	return name
+}
+func (r *InstanceTurso) Engine() string   { return "turso" }
+func (r *InstanceTurso) Build() BuildInfo { return r.build }
+
+// storeBuild saves build log next to the cached binary so it is available for the cache hits too
+func (r *InstanceTurso) storeBuild(cache *BuildCache) error {
+	data, err := os.ReadFile(r.buildLog())
+	if err != nil {
+		return err
+	}
+	_, err = cache.Put(r.buildKey(), "build.log", data)
+	if err != nil {
+		return err
+	}
+	os.Remove(r.buildLog())
+	return r.loadBuild(cache)
+}
+
+func (r *InstanceTurso) loadBuild(cache *BuildCache) error {
+	info, err := os.Stat(r.Binary)
+	if err != nil {
+		return err
+	}
+	r.build = BuildInfo{Size: info.Size()}
+	logPath, _, err := cache.Get(r.buildKey(), "build.log")
+	if err == nil {
+		r.build.Log = logPath
+	} else if !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
 func (r *InstanceTurso) RunCmd(path string, query string) []string {
 	return []string{r.bin(), "--quiet", "--output-mode", "list", path, query}
 }
+func (r *InstanceTurso) Parameters() (map[string]any, error) {
+	return map[string]any{
+		r.Name() + ".source":    r.Repo,
+		r.Name() + ".revision":  r.Revision,
+		r.Name() + ".key":       r.Key,
+		r.Name() + ".profile":   r.Profile,
+		r.Name() + ".features":  strings.Join(r.Features, ","),
+		r.Name() + ".rustflags": r.RustFlags,
+	}, nil
+}
 
-func DownloadRepo(repo, revision string, filename string) error {
-	Logger.Infof("download repo archive %v:%v to %v", repo, revision, filename)
-	_, err := os.Stat(filename)
-	if !os.IsNotExist(err) {
-		return err
-	} else if err == nil {
+func git(repo string, env []string, args ...string) (string, error) {
+	cmd := exec.Command("git", append([]string{"-C", repo}, args...)...)
+	cmd.Env = append(os.Environ(), env...)
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %v failed: %w", args, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// LocalTree resolves git tree hash for the revision in the local checkout;
+// for RevisionWorkingTree it snapshots the working tree (including untracked files) through the temporary index
+func LocalTree(repo string, revision string) (string, error) {
+	if revision != RevisionWorkingTree {
+		return git(repo, nil, "rev-parse", revision+"^{tree}")
+	}
+	index, err := git(repo, nil, "rev-parse", "--path-format=absolute", "--git-path", "index")
+	if err != nil {
+		return "", err
+	}
+	tmp, err := os.CreateTemp("", "turso-benchmark-index")
+	if err != nil {
+		return "", err
+	}
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+
+	// repo without any staged file has no index yet: tree is built from the empty index then
+	data, err := os.ReadFile(index)
+	if err != nil && !os.IsNotExist(err) {
+		return "", err
+	}
+	if err == nil {
+		err = os.WriteFile(tmp.Name(), data, 0o644)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		// git treats empty file as corrupted index, so it must not exist at all
+		os.Remove(tmp.Name())
+	}
+	env := []string{"GIT_INDEX_FILE=" + tmp.Name()}
+	if _, err := git(repo, env, "add", "--all"); err != nil {
+		return "", err
+	}
+	return git(repo, env, "write-tree")
+}
+
+func ArchiveLocalTree(repo string, tree string, filename string) error {
+	Logger.Infof("archive local repo %v tree %v to %v", repo, tree, filename)
+	if _, err := os.Stat(filename); err == nil {
 		Logger.Infof("file %v already exists", filename)
 		return nil
+	} else if !os.IsNotExist(err) {
+		return err
 	}
-	url := fmt.Sprintf("https://github.com/%v/archive/%v.zip", repo, revision)
-	response, err := http.Get(url)
+	absolute, err := filepath.Abs(filename)
 	if err != nil {
 		return err
 	}
-	file, err := os.Create(filename)
+	// archive is written to the temporary file so interrupted run doesn't leave truncated archive under the final name
+	tmp, err := os.CreateTemp(filepath.Dir(absolute), filepath.Base(absolute)+"-tmp")
 	if err != nil {
 		return err
 	}
-	defer file.Sync()
-
-	_, err = io.Copy(file, response.Body)
+	tmp.Close()
+	defer os.Remove(tmp.Name())
+	_, err = git(repo, nil, "archive", "--format=zip", fmt.Sprintf("--prefix=turso-%v/", tree), "-o", tmp.Name(), tree)
 	if err != nil {
 		return err
 	}
-	return nil
+	return os.Rename(tmp.Name(), absolute)
 }
 
+func DownloadRepo(repo, revision string, filename string) error {
+	Logger.Infof("download repo archive %v:%v to %v", repo, revision, filename)
+	url := fmt.Sprintf("https://github.com/%v/archive/%v.zip", repo, revision)
+	return DefaultDownloader.Download(url, filename, ValidateZip)
+}
+
+// UnpackRepo extracts zip archive into the temporary directory next to the target and atomically renames it into place;
+// single root directory of the archive (e.g. turso-<revision>/ in GitHub archives) is stripped
 func UnpackRepo(filename string, target string) error {
 	Logger.Infof("unpack repo from %v to %v", filename, target)
-	_, err := os.Stat(target)
-	if !os.IsNotExist(err) {
-		return err
-	} else if err == nil {
+	if _, err := os.Stat(target); err == nil {
 		Logger.Infof("directory %v already exists", target)
 		return nil
+	} else if !os.IsNotExist(err) {
+		return err
 	}
-	cmd := exec.Command("unzip", filename, "-d", target)
-	if err := cmd.Run(); err != nil {
+	archive, err := zip.OpenReader(filename)
+	if err != nil {
 		return err
 	}
-	entries, err := os.ReadDir(target)
+	defer archive.Close()
+
+	tmp, err := os.MkdirTemp(filepath.Dir(target), filepath.Base(target)+"-tmp")
 	if err != nil {
 		return err
 	}
-	Logger.Infof("entries: %v", entries)
-	err = os.Rename(path.Join(target, entries[0].Name()), entries[0].Name())
+	defer os.RemoveAll(tmp)
+
+	root := zipRoot(archive.File)
+	type link struct{ name, target string }
+	links := make([]link, 0)
+	for _, file := range archive.File {
+		if !filepath.IsLocal(file.Name) {
+			return fmt.Errorf("invalid archive entry: %v", file.Name)
+		}
+		name := strings.TrimPrefix(file.Name, root)
+		if name == "" {
+			continue
+		}
+		destination := filepath.Join(tmp, name)
+		mode := file.Mode()
+		switch {
+		case mode.IsDir():
+			if err := os.MkdirAll(destination, 0o755); err != nil {
+				return err
+			}
+		case mode&os.ModeSymlink != 0:
+			reader, err := file.Open()
+			if err != nil {
+				return err
+			}
+			value, err := io.ReadAll(reader)
+			reader.Close()
+			if err != nil {
+				return err
+			}
+			// link must point inside the extracted tree
+			resolved := filepath.Join(filepath.Dir(name), string(value))
+			if filepath.IsAbs(string(value)) || !filepath.IsLocal(resolved) {
+				return fmt.Errorf("invalid archive symlink: %v -> %v", file.Name, string(value))
+			}
+			links = append(links, link{name: filepath.Clean(name), target: string(value)})
+		case mode.IsRegular():
+			if err := unpackZipFile(file, destination); err != nil {
+				return err
+			}
+		}
+	}
+	// symlinks are created last so regular files are never written through them and their directories
+	// are created before any symlink exists
+	for _, link := range links {
+		if err := os.MkdirAll(filepath.Join(tmp, filepath.Dir(link.name)), 0o755); err != nil {
+			return err
+		}
+	}
+	for _, link := range links {
+		if err := os.Symlink(link.target, filepath.Join(tmp, link.name)); err != nil {
+			return err
+		}
+	}
+	// targets are checked only lexically, so chained links (d/l -> .., d/l2 -> l/..) could escape the tree:
+	// links which location or target passes through another link are rejected
+	for _, link := range links {
+		location, err := throughSymlink(tmp, link.name)
+		if err != nil {
+			return err
+		}
+		destination, err := throughSymlink(filepath.Join(tmp, filepath.Dir(link.name)), link.target)
+		if err != nil {
+			return err
+		}
+		if location || destination {
+			return fmt.Errorf("invalid archive symlink: %v -> %v passes through another symlink", link.name, link.target)
+		}
+	}
+	return os.Rename(tmp, target)
+}
+
+// throughSymlink checks whether path resolution of the relative name from the dir passes through a symlink
+// (the last component can be a symlink); name is not cleaned as "l/.." must resolve through the link l
+func throughSymlink(dir string, name string) (bool, error) {
+	parts := strings.Split(filepath.ToSlash(name), "/")
+	current := dir
+	for _, part := range parts[:len(parts)-1] {
+		switch part {
+		case "", ".":
+			continue
+		case "..":
+			current = filepath.Dir(current)
+			continue
+		}
+		current = filepath.Join(current, part)
+		info, err := os.Lstat(current)
+		if os.IsNotExist(err) {
+			return false, nil
+		} else if err != nil {
+			return false, err
+		}
+		if info.Mode()&os.ModeSymlink != 0 {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// zipRoot returns common root directory prefix (with trailing slash) of all entries or empty string
+func zipRoot(files []*zip.File) string {
+	root := ""
+	for _, file := range files {
+		i := strings.IndexByte(file.Name, '/')
+		if i < 0 {
+			return ""
+		}
+		if root == "" {
+			root = file.Name[:i+1]
+		} else if root != file.Name[:i+1] {
+			return ""
+		}
+	}
+	return root
+}
+
+func unpackZipFile(file *zip.File, destination string) error {
+	if err := os.MkdirAll(filepath.Dir(destination), 0o755); err != nil {
+		return err
+	}
+	reader, err := file.Open()
 	if err != nil {
 		return err
 	}
-	err = os.RemoveAll(target)
+	defer reader.Close()
+	perm := file.Mode().Perm()
+	if perm == 0 {
+		perm = 0o644
+	}
+	out, err := os.OpenFile(destination, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, perm|0o600)
 	if err != nil {
 		return err
 	}
-	err = os.Rename(entries[0].Name(), target)
+	_, err = io.Copy(out, reader)
 	if err != nil {
+		out.Close()
 		return err
 	}
-	return nil
+	return out.Close()
 }
 
-func BuildTurso(target string, profile string) error {
-	Logger.Infof("build turso at %v for profile %v", target, profile)
-	_, err := os.Stat(path.Join(target, "target", profile, "tursodb"))
-	if !os.IsNotExist(err) {
-		return err
-	} else if err == nil {
-		Logger.Infof("binary for profile %v already exists", profile)
-		return nil
+// cargoProfileDir returns directory name inside the cargo target dir for the build profile
+func cargoProfileDir(profile string) string {
+	switch profile {
+	case "dev", "test":
+		return "debug"
+	case "bench":
+		return "release"
 	}
-	cmd := exec.Command("cargo", "build", "--profile", profile, "--package", "turso_cli")
-	cmd.Dir = target
-	stdout, err := cmd.StdoutPipe()
+	return profile
+}
+
+// BuildTurso builds turso CLI from the target source tree in the targetDir and returns path to the built binary;
+// with compilerCache sccache is used automatically if it is available in the PATH, otherwise any configured
+// compiler wrapper is disabled
+func BuildTurso(target string, targetDir string, profile string, features []string, rustflags string, compilerCache bool, log io.Writer) (string, error) {
+	Logger.Infof("build turso at %v for profile %v with features %v and rustflags '%v'", target, profile, features, rustflags)
+	targetDir, err := filepath.Abs(targetDir)
 	if err != nil {
-		return err
+		return "", err
 	}
-	stderr, err := cmd.StderrPipe()
-	if err != nil {
-		return err
+	args := []string{"build", "--profile", profile, "--package", "turso_cli"}
+	if len(features) > 0 {
+		args = append(args, "--features", strings.Join(features, ","))
+	}
+	cmd := exec.Command("cargo", args...)
+	cmd.Dir = target
+	cmd.Env = append(os.Environ(), "CARGO_TARGET_DIR="+targetDir)
+	if rustflags != "" {
+		cmd.Env = append(cmd.Env, "RUSTFLAGS="+rustflags)
 	}
-	go func() { io.Copy(os.Stderr, stderr) }()
-	go func() { io.Copy(os.Stdout, stdout) }()
+	if !compilerCache {
+		cmd.Env = append(cmd.Env, "RUSTC_WRAPPER=", "CARGO_BUILD_RUSTC_WRAPPER=")
+	} else if sccache, err := exec.LookPath("sccache"); err == nil {
+		cmd.Env = append(cmd.Env, "RUSTC_WRAPPER="+sccache)
+	}
+	cmd.Stdout = io.MultiWriter(os.Stdout, log)
+	cmd.Stderr = io.MultiWriter(os.Stderr, log)
 
 	if err := cmd.Run(); err != nil {
-		return err
+		return "", err
 	}
 
-	return nil
+	return path.Join(targetDir, cargoProfileDir(profile), "tursodb"), nil
 }
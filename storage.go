@@ -2,8 +2,11 @@ package main
 
 import (
 	"bytes"
+	"compress/gzip"
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"io"
 	"net/http"
@@ -12,6 +15,8 @@ import (
 	"slices"
 	"strings"
 	"time"
+
+	"github.com/klauspost/compress/zstd"
 )
 
 type Storage struct {
@@ -19,14 +24,32 @@ type Storage struct {
 	GroupName string
 	ApiToken  string
 	AuthToken string
+	// ProfileChunkSize is the max size of the compressed profile content stored in a single row
+	ProfileChunkSize int
+	// ProfileBudget limits total compressed size of the profiles stored for the benchmark (zero means no limit)
+	ProfileBudget int64
 }
 
+const (
+	MeasurementTotalTime  = "total_time"
+	MeasurementNetTime    = "net_time"
+	MeasurementBuildTime  = "build_time"
+	MeasurementBinarySize = "binary_size"
+)
+
+// BuildName is the name used for the build artifacts of the runners in measurements and profiles tables
+const BuildName = "build"
+
 type BenchmarkResult struct {
-	Runner    string
-	Dataset   string
-	Name      string
-	TotalTime float64
-	Attempts  int
+	Runner      string
+	Dataset     string
+	Name        string
+	Measurement string
+	TotalTime   float64
+	Attempts    int
+	// Cache is the cache mode of the measurement (empty for measurements which do not run queries, e.g. build);
+	// it is stored in the cache column while the mode suffix of the Name only keeps modes apart (see CacheQueryName)
+	Cache string
 }
 
 type BenchmarkProfile struct {
@@ -34,15 +57,27 @@ type BenchmarkProfile struct {
 	Dataset string
 	Name    string
 	Files   []string
+	// Warning describes profiler failure which was not fatal for the benchmark
+	Warning string
+	// Temporary marks files which must be removed from the local disk after upload
+	Temporary bool
 }
 
 type BenchmarkInfo struct {
 	Repo     string
 	Branch   string
 	Revision string
-	Dataset  string
-	Results  string
-	Profiles string
+	// Compare lists additional revisions benchmarked together with the Revision within the same results db
+	Compare []string
+	// Profiling policy of the benchmark (see ShouldProfile); runner default is used if empty
+	Profiling string
+	Dataset   string
+	Results   string
+	Profiles  string
+}
+
+func (b BenchmarkInfo) Revisions() []string {
+	return append([]string{b.Revision}, b.Compare...)
 }
 
 func (s *Storage) CreateDatabase(name string) error {
@@ -93,11 +128,256 @@ func (s *Storage) InitBenchmarkMeta(meta *sql.DB) error {
 	if err != nil {
 		return err
 	}
+	for _, column := range []string{"compare", "profiling"} {
+		if _, err := meta.Exec(fmt.Sprintf("SELECT %v FROM benchmarks LIMIT 0", column)); err != nil {
+			_, err = meta.Exec(fmt.Sprintf("ALTER TABLE benchmarks ADD COLUMN %v TEXT", column))
+			if err != nil {
+				return err
+			}
+		}
+	}
+	_, err = meta.Exec(`CREATE TABLE IF NOT EXISTS history (
+		repo TEXT,
+		branch TEXT,
+		revision TEXT,
+		commit_time INTEGER,
+		fingerprint TEXT,
+		results TEXT,
+		runner TEXT,
+		dataset TEXT,
+		name TEXT,
+		measurement TEXT,
+		samples INTEGER,
+		median REAL,
+		ci_low REAL,
+		ci_high REAL,
+		PRIMARY KEY (results, runner, dataset, name, measurement)
+	)`)
+	if err != nil {
+		return err
+	}
+	if _, err := meta.Exec("SELECT host FROM history LIMIT 0"); err != nil {
+		_, err = meta.Exec("ALTER TABLE history ADD COLUMN host TEXT")
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
 
+// HistoryEntry is the summary of the query samples of the single runner in the finished benchmark
+type HistoryEntry struct {
+	Repo     string
+	Branch   string
+	Revision string
+	// CommitTime is zero if commit time is unknown
+	CommitTime  time.Time
+	Fingerprint string
+	// Host is the machine of the benchmark (see HistoryHost), empty for history ingested before hosts were recorded
+	Host        string
+	Results     string
+	Runner      string
+	Dataset     string
+	Name        string
+	Measurement string
+	Samples     int
+	Median      float64
+	CILow       float64
+	CIHigh      float64
+}
+
+func (s *Storage) AddHistory(meta *sql.DB, entries []HistoryEntry) error {
+	tx, err := meta.BeginTx(context.Background(), nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+	for _, entry := range entries {
+		var commitTime any
+		if !entry.CommitTime.IsZero() {
+			commitTime = entry.CommitTime.Unix()
+		}
+		_, err := tx.Exec(
+			`INSERT OR REPLACE INTO history
+			(repo, branch, revision, commit_time, fingerprint, results, runner, dataset, name, measurement, samples, median, ci_low, ci_high, host)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			entry.Repo,
+			entry.Branch,
+			entry.Revision,
+			commitTime,
+			entry.Fingerprint,
+			entry.Results,
+			entry.Runner,
+			entry.Dataset,
+			entry.Name,
+			entry.Measurement,
+			entry.Samples,
+			entry.Median,
+			entry.CILow,
+			entry.CIHigh,
+			entry.Host,
+		)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// HistoryResults returns names of the results dbs which are already summarized in the history table
+func (s *Storage) HistoryResults(meta *sql.DB) (map[string]bool, error) {
+	rows, err := meta.Query("SELECT DISTINCT results FROM history")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make(map[string]bool, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		results[name] = true
+	}
+	return results, rows.Err()
+}
+
+// History returns summaries of the branch benchmarks executed on the host or on the hosts with the fingerprint
+// (empty host or fingerprint matches nothing) in the order of ingestion
+func (s *Storage) History(meta *sql.DB, branch string, host string, fingerprint string, dataset string, measurement string) ([]HistoryEntry, error) {
+	rows, err := meta.Query(
+		`SELECT repo, branch, revision, commit_time, fingerprint, COALESCE(host, ''), results, runner, dataset, name, measurement, samples, median, ci_low, ci_high
+		FROM history WHERE branch = ? AND ((? != '' AND host = ?) OR (? != '' AND fingerprint = ?)) AND (? = '' OR dataset = ?) AND measurement = ? ORDER BY rowid`,
+		branch,
+		host,
+		host,
+		fingerprint,
+		fingerprint,
+		dataset,
+		dataset,
+		measurement,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	entries := make([]HistoryEntry, 0)
+	for rows.Next() {
+		var entry HistoryEntry
+		var commitTime sql.NullInt64
+		err := rows.Scan(
+			&entry.Repo,
+			&entry.Branch,
+			&entry.Revision,
+			&commitTime,
+			&entry.Fingerprint,
+			&entry.Host,
+			&entry.Results,
+			&entry.Runner,
+			&entry.Dataset,
+			&entry.Name,
+			&entry.Measurement,
+			&entry.Samples,
+			&entry.Median,
+			&entry.CILow,
+			&entry.CIHigh,
+		)
+		if err != nil {
+			return nil, err
+		}
+		if commitTime.Valid {
+			entry.CommitTime = time.Unix(commitTime.Int64, 0).UTC()
+		}
+		entries = append(entries, entry)
+	}
+	return entries, rows.Err()
+}
+
+// MissingCommitTimes returns revisions summarized in the history table without commit time
+func (s *Storage) MissingCommitTimes(meta *sql.DB) ([]BenchmarkInfo, error) {
+	rows, err := meta.Query("SELECT DISTINCT repo, revision FROM history WHERE commit_time IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	benchmarks := make([]BenchmarkInfo, 0)
+	for rows.Next() {
+		var benchmark BenchmarkInfo
+		if err := rows.Scan(&benchmark.Repo, &benchmark.Revision); err != nil {
+			return nil, err
+		}
+		benchmarks = append(benchmarks, benchmark)
+	}
+	return benchmarks, rows.Err()
+}
+
+func (s *Storage) SetCommitTime(meta *sql.DB, repo string, revision string, commitTime time.Time) error {
+	_, err := meta.Exec("UPDATE history SET commit_time = ? WHERE repo = ? AND revision = ? AND commit_time IS NULL", commitTime.Unix(), repo, revision)
+	return err
+}
+
+// LatestHost returns host and its fingerprint of the latest summarized benchmark of the branch
+func (s *Storage) LatestHost(meta *sql.DB, branch string) (string, string, error) {
+	var host, fingerprint string
+	err := meta.QueryRow("SELECT COALESCE(host, ''), fingerprint FROM history WHERE branch = ? ORDER BY rowid DESC LIMIT 1", branch).Scan(&host, &fingerprint)
+	if err != nil {
+		return "", "", fmt.Errorf("history for branch %v not found: %w", branch, err)
+	}
+	return host, fingerprint, nil
+}
+
+// MissingHosts returns results dbs summarized in the history table without host
+func (s *Storage) MissingHosts(meta *sql.DB) ([]string, error) {
+	rows, err := meta.Query("SELECT DISTINCT results FROM history WHERE host IS NULL")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	results := make([]string, 0)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		results = append(results, name)
+	}
+	return results, rows.Err()
+}
+
+func (s *Storage) SetHistoryHost(meta *sql.DB, results string, host string) error {
+	_, err := meta.Exec("UPDATE history SET host = ? WHERE results = ?", host, results)
+	return err
+}
+
+// FinishedBenchmarks returns all finished benchmarks in the order of their creation
+func (s *Storage) FinishedBenchmarks(meta *sql.DB) ([]BenchmarkInfo, error) {
+	rows, err := meta.Query("SELECT repo, branch, revision, dataset, results, profiles FROM benchmarks WHERE finished = 1 ORDER BY rowid")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	benchmarks := make([]BenchmarkInfo, 0)
+	for rows.Next() {
+		var benchmark BenchmarkInfo
+		err := rows.Scan(&benchmark.Repo, &benchmark.Branch, &benchmark.Revision, &benchmark.Dataset, &benchmark.Results, &benchmark.Profiles)
+		if err != nil {
+			return nil, err
+		}
+		benchmarks = append(benchmarks, benchmark)
+	}
+	return benchmarks, rows.Err()
+}
+
 func (s *Storage) AddBenchmarkDb(meta *sql.DB, benchmark BenchmarkInfo) error {
-	_, err := meta.Exec("INSERT INTO benchmarks VALUES (?, ?, ?, ?, NULL, NULL)", benchmark.Repo, benchmark.Branch, benchmark.Revision, benchmark.Dataset)
+	_, err := meta.Exec(
+		"INSERT INTO benchmarks (repo, branch, revision, dataset, compare, profiling, finished) VALUES (?, ?, ?, ?, ?, ?, 0)",
+		benchmark.Repo,
+		benchmark.Branch,
+		benchmark.Revision,
+		benchmark.Dataset,
+		strings.Join(benchmark.Compare, ","),
+		benchmark.Profiling,
+	)
 	if err != nil {
 		return err
 	}
@@ -105,17 +385,19 @@ func (s *Storage) AddBenchmarkDb(meta *sql.DB, benchmark BenchmarkInfo) error {
 }
 
 func (s *Storage) FetchBenchmarksToRun(meta *sql.DB) ([]BenchmarkInfo, error) {
-	rows, err := meta.Query("SELECT repo, branch, revision, dataset, results, profiles FROM benchmarks WHERE finished != 1")
+	rows, err := meta.Query("SELECT repo, branch, revision, dataset, results, profiles, COALESCE(compare, ''), COALESCE(profiling, '') FROM benchmarks WHERE finished != 1")
 	if err != nil {
 		return nil, err
 	}
 	benchmarks := make([]BenchmarkInfo, 0)
-	var benchmark BenchmarkInfo
 	for rows.Next() {
-		err = rows.Scan(&benchmark.Repo, &benchmark.Branch, &benchmark.Revision, &benchmark.Dataset, &benchmark.Results, &benchmark.Profiles)
+		var benchmark BenchmarkInfo
+		var compare string
+		err = rows.Scan(&benchmark.Repo, &benchmark.Branch, &benchmark.Revision, &benchmark.Dataset, &benchmark.Results, &benchmark.Profiles, &compare, &benchmark.Profiling)
 		if err != nil {
 			return nil, err
 		}
+		benchmark.Compare = strings.FieldsFunc(compare, func(r rune) bool { return r == ',' })
 		benchmarks = append(benchmarks, benchmark)
 	}
 	return benchmarks, nil
@@ -179,24 +461,85 @@ func (s *Storage) WrittenQueries(db *sql.DB, benchmark BenchmarkInfo, dataset st
 	return results, nil
 }
 
-func (s *Storage) InitResultsDb(db *sql.DB, meta map[string]any) error {
-	_, err := db.Exec("CREATE TABLE IF NOT EXISTS parameters (name TEXT PRIMARY KEY, value)")
+func (s *Storage) Measurements(db *sql.DB, dataset string, name string, measurement string) (map[string][]float64, error) {
+	rows, err := db.Query(
+		"SELECT runner, value FROM measurements WHERE dataset = ? AND name = ? AND measurement = ? ORDER BY sample",
+		dataset,
+		name,
+		measurement,
+	)
 	if err != nil {
-		return err
+		return nil, err
+	}
+	results := make(map[string][]float64, 0)
+	for rows.Next() {
+		var runner string
+		var value float64
+		if err := rows.Scan(&runner, &value); err != nil {
+			return nil, err
+		}
+		results[runner] = append(results[runner], value)
+	}
+	return results, nil
+}
+
+type SampleKey struct {
+	Runner      string
+	Name        string
+	Measurement string
+}
+
+// Samples returns all measurements of the dataset grouped by runner, query and measurement
+func (s *Storage) Samples(db *sql.DB, dataset string) (map[SampleKey][]float64, error) {
+	rows, err := db.Query("SELECT runner, name, measurement, value FROM measurements WHERE dataset = ? ORDER BY sample", dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	samples := make(map[SampleKey][]float64, 0)
+	for rows.Next() {
+		var key SampleKey
+		var value float64
+		if err := rows.Scan(&key.Runner, &key.Name, &key.Measurement, &value); err != nil {
+			return nil, err
+		}
+		samples[key] = append(samples[key], value)
+	}
+	return samples, rows.Err()
+}
+
+func (s *Storage) AddParameters(db *sql.DB, meta map[string]any) error {
+	if len(meta) == 0 {
+		return nil
 	}
 	parameters := make([]any, 0)
-	parameters = append(parameters, "time", time.Now().Format("2006-01-02 15:04:05"))
 	for key, value := range meta {
 		parameters = append(parameters, key, fmt.Sprintf("%v", value))
 	}
 	placeholders := strings.Join(slices.Repeat([]string{"(?, ?)"}, len(parameters)/2), ", ")
-	_, err = db.Exec(
+	_, err := db.Exec(
 		fmt.Sprintf("INSERT INTO parameters VALUES %v ON CONFLICT DO NOTHING", placeholders),
 		parameters...,
 	)
 	if err != nil {
 		return err
 	}
+	return nil
+}
+
+func (s *Storage) InitResultsDb(db *sql.DB, meta map[string]any) error {
+	_, err := db.Exec("CREATE TABLE IF NOT EXISTS parameters (name TEXT PRIMARY KEY, value)")
+	if err != nil {
+		return err
+	}
+	err = s.AddParameters(db, map[string]any{"time": time.Now().Format("2006-01-02 15:04:05")})
+	if err != nil {
+		return err
+	}
+	err = s.AddParameters(db, meta)
+	if err != nil {
+		return err
+	}
 	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS measurements (
 		runner TEXT,
 		dataset TEXT,
@@ -205,8 +548,13 @@ func (s *Storage) InitResultsDb(db *sql.DB, meta map[string]any) error {
 		sample INTEGER,
         iterations REAL, 
         value REAL,
+		cache TEXT,
 		PRIMARY KEY (runner, dataset, name, measurement, sample)
     )`)
+	if err != nil {
+		return err
+	}
+	err = s.MigrateResultsDb(db)
 	if err != nil {
 		return err
 	}
@@ -225,6 +573,38 @@ func (s *Storage) InitResultsDb(db *sql.DB, meta map[string]any) error {
 	return nil
 }
 
+// MigrateResultsDb adds tables and columns missing in the results db of the benchmark started by older version
+func (s *Storage) MigrateResultsDb(db *sql.DB) error {
+	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS warnings (
+		runner TEXT,
+		dataset TEXT,
+		name TEXT,
+		message TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS noise (
+		dataset TEXT,
+		name TEXT,
+		load REAL,
+		cpu REAL,
+		governor TEXT,
+		waited REAL,
+		violations TEXT
+	)`)
+	if err != nil {
+		return err
+	}
+	if _, err := db.Exec("SELECT cache FROM measurements LIMIT 0"); err != nil {
+		_, err = db.Exec("ALTER TABLE measurements ADD COLUMN cache TEXT")
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 func (s *Storage) InitProfilesDb(db *sql.DB) error {
 	_, err := db.Exec(`CREATE TABLE IF NOT EXISTS profiles (
         runner TEXT,
@@ -234,6 +614,28 @@ func (s *Storage) InitProfilesDb(db *sql.DB) error {
         content BLOB,
         PRIMARY KEY (runner, dataset, name, filename)
     )`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS profile_files (
+		runner TEXT,
+		dataset TEXT,
+		name TEXT,
+		filename TEXT,
+		hash TEXT,
+		size INTEGER,
+		encoding TEXT,
+		PRIMARY KEY (runner, dataset, name, filename)
+	)`)
+	if err != nil {
+		return err
+	}
+	_, err = db.Exec(`CREATE TABLE IF NOT EXISTS profile_chunks (
+		hash TEXT,
+		chunk INTEGER,
+		content BLOB,
+		PRIMARY KEY (hash, chunk)
+	)`)
 	if err != nil {
 		return err
 	}
@@ -246,16 +648,21 @@ func (s *Storage) UpdateBenchmarkDb(db *sql.DB, results []BenchmarkResult) error
 	if err != nil {
 		return err
 	}
-	for i, result := range results {
+	samples := make(map[string]int, 0)
+	for _, result := range results {
+		key := fmt.Sprintf("%v:%v:%v:%v", result.Runner, result.Dataset, result.Name, result.Measurement)
+		sample := samples[key]
+		samples[key]++
 		_, err = tx.Exec(
-			"INSERT INTO measurements VALUES (?, ?, ?, ?, ?, ?, ?)",
+			"INSERT INTO measurements (runner, dataset, name, measurement, sample, iterations, value, cache) VALUES (?, ?, ?, ?, ?, ?, ?, ?)",
 			result.Runner,
 			result.Dataset,
 			result.Name,
-			"total_time",
-			i,
+			result.Measurement,
+			sample,
 			result.Attempts,
 			result.TotalTime,
+			result.Cache,
 		)
 		if err != nil {
 			return err
@@ -264,16 +671,373 @@ func (s *Storage) UpdateBenchmarkDb(db *sql.DB, results []BenchmarkResult) error
 	return tx.Commit()
 }
 
-func (s *Storage) UploadProfileDb(db *sql.DB, profile BenchmarkProfile) error {
+func (s *Storage) AddWarning(db *sql.DB, runner string, dataset string, name string, message string) error {
+	_, err := db.Exec("INSERT INTO warnings VALUES (?, ?, ?, ?)", runner, dataset, name, message)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// AddNoise records noise observed before the query
+func (s *Storage) AddNoise(db *sql.DB, record NoiseRecord) error {
+	_, err := db.Exec(
+		"INSERT INTO noise VALUES (?, ?, ?, ?, ?, ?, ?)",
+		record.Dataset,
+		record.Name,
+		record.Sample.Load,
+		record.Sample.CPU,
+		record.Sample.Governor,
+		record.Waited.Seconds(),
+		strings.Join(record.Violations, "; "),
+	)
+	return err
+}
+
+type Warning struct {
+	Runner  string
+	Name    string
+	Message string
+}
+
+// Warnings returns warnings recorded for the dataset (warnings table is created lazily and can be absent)
+func (s *Storage) Warnings(db *sql.DB, dataset string) ([]Warning, error) {
+	var exists bool
+	err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM sqlite_master WHERE type = 'table' AND name = 'warnings')").Scan(&exists)
+	if err != nil || !exists {
+		return nil, err
+	}
+	rows, err := db.Query("SELECT runner, name, message FROM warnings WHERE dataset = ? ORDER BY rowid", dataset)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	warnings := make([]Warning, 0)
+	for rows.Next() {
+		var warning Warning
+		if err := rows.Scan(&warning.Runner, &warning.Name, &warning.Message); err != nil {
+			return nil, err
+		}
+		warnings = append(warnings, warning)
+	}
+	return warnings, rows.Err()
+}
+
+type ProfileFile struct {
+	Filename string
+	Content  []byte
+}
+
+const (
+	encodingZstd     = "zstd"
+	encodingGzipZstd = "gzip+zstd"
+)
+
+// DownloadProfileDb restores original content of the profile files (legacy uncompressed profiles table is used as a fallback)
+func (s *Storage) DownloadProfileDb(db *sql.DB, runner string, dataset string, name string) ([]ProfileFile, error) {
+	rows, err := db.Query("SELECT filename, hash, encoding FROM profile_files WHERE runner = ? AND dataset = ? AND name = ?", runner, dataset, name)
+	if err != nil {
+		return s.downloadLegacyProfileDb(db, runner, dataset, name)
+	}
+	type stored struct{ filename, hash, encoding string }
+	entries := make([]stored, 0)
+	for rows.Next() {
+		var entry stored
+		if err := rows.Scan(&entry.filename, &entry.hash, &entry.encoding); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		entries = append(entries, entry)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	if len(entries) == 0 {
+		return s.downloadLegacyProfileDb(db, runner, dataset, name)
+	}
+
+	files := make([]ProfileFile, 0, len(entries))
+	for _, entry := range entries {
+		compressed, err := s.readProfileChunks(db, entry.hash)
+		if err != nil {
+			return nil, err
+		}
+		content, err := decodeProfile(compressed, entry.encoding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to decode profile %v: %w", entry.filename, err)
+		}
+		files = append(files, ProfileFile{Filename: entry.filename, Content: content})
+	}
+	return files, nil
+}
+
+func (s *Storage) downloadLegacyProfileDb(db *sql.DB, runner string, dataset string, name string) ([]ProfileFile, error) {
+	rows, err := db.Query("SELECT filename, content FROM profiles WHERE runner = ? AND dataset = ? AND name = ?", runner, dataset, name)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	files := make([]ProfileFile, 0)
+	for rows.Next() {
+		var file ProfileFile
+		if err := rows.Scan(&file.Filename, &file.Content); err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+	return files, rows.Err()
+}
+
+func (s *Storage) readProfileChunks(db *sql.DB, hash string) ([]byte, error) {
+	rows, err := db.Query("SELECT content FROM profile_chunks WHERE hash = ? ORDER BY chunk", hash)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var content []byte
+	for rows.Next() {
+		var chunk []byte
+		if err := rows.Scan(&chunk); err != nil {
+			return nil, err
+		}
+		content = append(content, chunk...)
+	}
+	return content, rows.Err()
+}
+
+// FindBenchmark returns latest finished benchmark for the revision (or its prefix) and dataset
+func (s *Storage) FindBenchmark(meta *sql.DB, revision string, dataset string) (BenchmarkInfo, error) {
+	var benchmark BenchmarkInfo
+	var compare string
+	err := meta.QueryRow(
+		`SELECT repo, branch, revision, dataset, results, profiles, COALESCE(compare, ''), COALESCE(profiling, '') FROM benchmarks
+		WHERE revision LIKE ? AND dataset = ? AND finished = 1 ORDER BY rowid DESC LIMIT 1`,
+		revision+"%",
+		dataset,
+	).Scan(&benchmark.Repo, &benchmark.Branch, &benchmark.Revision, &benchmark.Dataset, &benchmark.Results, &benchmark.Profiles, &compare, &benchmark.Profiling)
+	if err != nil {
+		return BenchmarkInfo{}, fmt.Errorf("benchmark for revision %v and dataset %v not found: %w", revision, dataset, err)
+	}
+	benchmark.Compare = strings.FieldsFunc(compare, func(r rune) bool { return r == ',' })
+	return benchmark, nil
+}
+
+// LatestBenchmark returns latest benchmark for the revision (or its prefix) and dataset even if it is not finished
+func (s *Storage) LatestBenchmark(meta *sql.DB, revision string, dataset string) (BenchmarkInfo, bool, error) {
+	var benchmark BenchmarkInfo
+	var compare string
+	var finished bool
+	err := meta.QueryRow(
+		`SELECT repo, branch, revision, dataset, COALESCE(results, ''), COALESCE(profiles, ''), COALESCE(compare, ''), COALESCE(profiling, ''), COALESCE(finished, 0) FROM benchmarks
+		WHERE revision LIKE ? AND dataset = ? ORDER BY rowid DESC LIMIT 1`,
+		revision+"%",
+		dataset,
+	).Scan(&benchmark.Repo, &benchmark.Branch, &benchmark.Revision, &benchmark.Dataset, &benchmark.Results, &benchmark.Profiles, &compare, &benchmark.Profiling, &finished)
+	if err != nil {
+		return BenchmarkInfo{}, false, fmt.Errorf("benchmark for revision %v and dataset %v not found: %w", revision, dataset, err)
+	}
+	if benchmark.Results == "" {
+		return BenchmarkInfo{}, false, fmt.Errorf("benchmark %v is not started yet", benchmark)
+	}
+	benchmark.Compare = strings.FieldsFunc(compare, func(r rune) bool { return r == ',' })
+	return benchmark, finished, nil
+}
+
+// BaselineCandidates returns finished benchmarks of the branch for the same repo and dataset but different revision (latest first)
+func (s *Storage) BaselineCandidates(meta *sql.DB, benchmark BenchmarkInfo, branch string) ([]BenchmarkInfo, error) {
+	rows, err := meta.Query(
+		`SELECT repo, branch, revision, dataset, results, profiles FROM benchmarks
+		WHERE repo = ? AND branch = ? AND dataset = ? AND revision != ? AND finished = 1 ORDER BY rowid DESC`,
+		benchmark.Repo,
+		branch,
+		benchmark.Dataset,
+		benchmark.Revision,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	candidates := make([]BenchmarkInfo, 0)
+	for rows.Next() {
+		var candidate BenchmarkInfo
+		err := rows.Scan(&candidate.Repo, &candidate.Branch, &candidate.Revision, &candidate.Dataset, &candidate.Results, &candidate.Profiles)
+		if err != nil {
+			return nil, err
+		}
+		candidates = append(candidates, candidate)
+	}
+	return candidates, rows.Err()
+}
+
+// encodeProfile re-compresses profile content with zstd (gzip files are decompressed first)
+func encodeProfile(filename string, data []byte) ([]byte, string, error) {
+	encoding := encodingZstd
+	if strings.HasSuffix(filename, ".gz") {
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return nil, "", err
+		}
+		data, err = io.ReadAll(reader)
+		if err != nil {
+			return nil, "", err
+		}
+		encoding = encodingGzipZstd
+	}
+	encoder, err := zstd.NewWriter(nil, zstd.WithEncoderLevel(zstd.SpeedBetterCompression))
+	if err != nil {
+		return nil, "", err
+	}
+	defer encoder.Close()
+	return encoder.EncodeAll(data, nil), encoding, nil
+}
+
+func decodeProfile(compressed []byte, encoding string) ([]byte, error) {
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, err
+	}
+	defer decoder.Close()
+	data, err := decoder.DecodeAll(compressed, nil)
+	if err != nil {
+		return nil, err
+	}
+	switch encoding {
+	case encodingZstd:
+		return data, nil
+	case encodingGzipZstd:
+		var buffer bytes.Buffer
+		writer := gzip.NewWriter(&buffer)
+		if _, err := writer.Write(data); err != nil {
+			return nil, err
+		}
+		if err := writer.Close(); err != nil {
+			return nil, err
+		}
+		return buffer.Bytes(), nil
+	}
+	return nil, fmt.Errorf("unknown profile encoding: %v", encoding)
+}
+
+// ProfileUpload is the profile file prepared for the upload: Chunks are empty if the content is already stored
+type ProfileUpload struct {
+	File     string
+	Hash     string
+	Size     int
+	Encoding string
+	Chunks   [][]byte
+}
+
+// SkippedProfile is the profile file which was not uploaded (its local file must be kept)
+type SkippedProfile struct {
+	File   string
+	Reason string
+}
+
+// PlanProfileUpload splits compressed files into chunks of chunkSize (non-positive means single chunk); content which
+// is already stored (or planned earlier) is not uploaded again and files which new content does not fit into the
+// budget (non-positive means no limit) with used bytes are skipped
+func PlanProfileUpload(files []ProfileUpload, contents [][]byte, stored func(hash string) (bool, error), used int64, budget int64, chunkSize int) ([]ProfileUpload, []SkippedProfile, error) {
+	uploads := make([]ProfileUpload, 0, len(files))
+	skipped := make([]SkippedProfile, 0)
+	planned := make(map[string]bool)
+	for i, file := range files {
+		content := contents[i]
+		exists := planned[file.Hash]
+		if !exists {
+			var err error
+			exists, err = stored(file.Hash)
+			if err != nil {
+				return nil, nil, err
+			}
+		}
+		if !exists {
+			if budget > 0 && used+int64(len(content)) > budget {
+				skipped = append(skipped, SkippedProfile{
+					File:   file.File,
+					Reason: fmt.Sprintf("profile %v (%v bytes) exceeds budget: %v of %v bytes used", filepath.Base(file.File), len(content), used, budget),
+				})
+				continue
+			}
+			size := chunkSize
+			if size <= 0 {
+				size = len(content) + 1
+			}
+			for offset := 0; offset < len(content) || offset == 0; offset += size {
+				file.Chunks = append(file.Chunks, content[offset:min(offset+size, len(content))])
+			}
+			used += int64(len(content))
+			planned[file.Hash] = true
+		}
+		uploads = append(uploads, file)
+	}
+	return uploads, skipped, nil
+}
+
+// UploadProfileDb stores profile files compressed with zstd and split into chunks; identical content is stored once
+// and files which do not fit into the ProfileBudget are skipped
+func (s *Storage) UploadProfileDb(db *sql.DB, profile BenchmarkProfile) ([]SkippedProfile, error) {
+	files := make([]ProfileUpload, 0, len(profile.Files))
+	contents := make([][]byte, 0, len(profile.Files))
 	for _, file := range profile.Files {
 		data, err := os.ReadFile(file)
 		if err != nil {
-			return err
+			return nil, err
 		}
-		_, err = db.Exec("INSERT INTO profiles VALUES (?, ?, ?, ?, ?)", profile.Runner, profile.Dataset, profile.Name, filepath.Base(file), data)
+		hash := sha256.Sum256(data)
+		compressed, encoding, err := encodeProfile(file, data)
 		if err != nil {
-			return err
+			return nil, fmt.Errorf("failed to compress profile %v: %w", file, err)
 		}
+		files = append(files, ProfileUpload{File: file, Hash: hex.EncodeToString(hash[:]), Size: len(data), Encoding: encoding})
+		contents = append(contents, compressed)
 	}
-	return nil
+	var used int64
+	if s.ProfileBudget > 0 {
+		err := db.QueryRow("SELECT COALESCE(SUM(LENGTH(content)), 0) FROM profile_chunks").Scan(&used)
+		if err != nil {
+			return nil, err
+		}
+	}
+	stored := func(hash string) (bool, error) {
+		var exists bool
+		err := db.QueryRow("SELECT EXISTS (SELECT 1 FROM profile_chunks WHERE hash = ?)", hash).Scan(&exists)
+		return exists, err
+	}
+	uploads, skipped, err := PlanProfileUpload(files, contents, stored, used, s.ProfileBudget, s.ProfileChunkSize)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, upload := range uploads {
+		tx, err := db.BeginTx(context.Background(), nil)
+		if err != nil {
+			return nil, err
+		}
+		for i, chunk := range upload.Chunks {
+			_, err = tx.Exec("INSERT OR REPLACE INTO profile_chunks VALUES (?, ?, ?)", upload.Hash, i, chunk)
+			if err != nil {
+				tx.Rollback()
+				return nil, err
+			}
+		}
+		_, err = tx.Exec(
+			"INSERT OR REPLACE INTO profile_files VALUES (?, ?, ?, ?, ?, ?, ?)",
+			profile.Runner,
+			profile.Dataset,
+			profile.Name,
+			filepath.Base(upload.File),
+			upload.Hash,
+			upload.Size,
+			upload.Encoding,
+		)
+		if err != nil {
+			tx.Rollback()
+			return nil, err
+		}
+		if err := tx.Commit(); err != nil {
+			return nil, err
+		}
+	}
+	return skipped, nil
 }
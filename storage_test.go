@@ -0,0 +1,85 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestEncodeProfile(t *testing.T) {
+	data := bytes.Repeat([]byte("main;turso::execute;sqlite3VdbeExec 1\n"), 1024)
+
+	compressed, encoding, err := encodeProfile("profile.folded", data)
+	require.Nil(t, err)
+	require.Equal(t, encodingZstd, encoding)
+	require.Less(t, len(compressed), len(data))
+	decoded, err := decodeProfile(compressed, encoding)
+	require.Nil(t, err)
+	require.Equal(t, data, decoded)
+
+	var buffer bytes.Buffer
+	writer := gzip.NewWriter(&buffer)
+	_, err = writer.Write(data)
+	require.Nil(t, err)
+	require.Nil(t, writer.Close())
+
+	compressed, encoding, err = encodeProfile("profile.json.gz", buffer.Bytes())
+	require.Nil(t, err)
+	require.Equal(t, encodingGzipZstd, encoding)
+	decoded, err = decodeProfile(compressed, encoding)
+	require.Nil(t, err)
+	reader, err := gzip.NewReader(bytes.NewReader(decoded))
+	require.Nil(t, err)
+	content, err := io.ReadAll(reader)
+	require.Nil(t, err)
+	require.Equal(t, data, content)
+
+	_, err = decodeProfile(compressed, "brotli")
+	require.NotNil(t, err)
+}
+
+func TestPlanProfileUpload(t *testing.T) {
+	files := []ProfileUpload{
+		{File: "a.folded", Hash: "a", Size: 100},
+		{File: "stored.folded", Hash: "stored", Size: 100},
+		{File: "a-copy.folded", Hash: "a", Size: 100},
+		{File: "large.folded", Hash: "large", Size: 100},
+		{File: "b.folded", Hash: "b", Size: 100},
+		{File: "empty.folded", Hash: "empty", Size: 0},
+	}
+	contents := [][]byte{
+		[]byte("aaaaaaa"),
+		[]byte("stored"),
+		[]byte("aaaaaaa"),
+		bytes.Repeat([]byte("l"), 20),
+		[]byte("bb"),
+		{},
+	}
+	stored := func(hash string) (bool, error) { return hash == "stored", nil }
+
+	// chunking: content is split into chunks, already stored and duplicate contents are not uploaded again
+	uploads, skipped, err := PlanProfileUpload(files, contents, stored, 0, 0, 3)
+	require.Nil(t, err)
+	require.Empty(t, skipped)
+	require.Len(t, uploads, len(files))
+	require.Equal(t, [][]byte{[]byte("aaa"), []byte("aaa"), []byte("a")}, uploads[0].Chunks)
+	require.Empty(t, uploads[1].Chunks)
+	require.Empty(t, uploads[2].Chunks)
+	require.Len(t, uploads[3].Chunks, 7)
+	require.Equal(t, [][]byte{{}}, uploads[5].Chunks)
+
+	// budget: only new content is accounted and files which do not fit are skipped while smaller ones still fit
+	uploads, skipped, err = PlanProfileUpload(files, contents, stored, 10, 20, 0)
+	require.Nil(t, err)
+	require.Equal(t, []SkippedProfile{{File: "large.folded", Reason: "profile large.folded (20 bytes) exceeds budget: 17 of 20 bytes used"}}, skipped)
+	names := make([]string, 0)
+	for _, upload := range uploads {
+		names = append(names, upload.File)
+	}
+	require.Equal(t, []string{"a.folded", "stored.folded", "a-copy.folded", "b.folded", "empty.folded"}, names)
+	require.Equal(t, [][]byte{[]byte("aaaaaaa")}, uploads[0].Chunks)
+	require.Equal(t, [][]byte{[]byte("bb")}, uploads[3].Chunks)
+}
@@ -3,11 +3,17 @@ package main
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"maps"
 	"math/rand"
+	"os"
 	"path"
+	"path/filepath"
 	"runtime"
 	"slices"
+	"strconv"
+	"strings"
 	"time"
 
 	"github.com/shirou/gopsutil/cpu"
@@ -26,8 +32,39 @@ type System struct {
 	id          string
 	meta        string
 	path        string
+	commitTimes CommitTimes
 	sleepDelay  time.Duration
 	errorDelay  time.Duration
+	// postponed benchmarks aborted because of the noise are not executed until the deadline
+	postponed map[string]postponement
+}
+
+type postponement struct {
+	until time.Time
+	delay time.Duration
+}
+
+// maxPostponeDelay limits exponential backoff of the benchmarks aborted because of the noise
+const maxPostponeDelay = time.Hour
+
+// postpone delays next execution of the benchmark: delay starts from errorDelay and doubles after every abort
+func (s *System) postpone(benchmark BenchmarkInfo, now time.Time) time.Duration {
+	if s.postponed == nil {
+		s.postponed = make(map[string]postponement)
+	}
+	key := fmt.Sprint(benchmark)
+	delay := s.errorDelay
+	if previous, ok := s.postponed[key]; ok {
+		delay = min(2*previous.delay, maxPostponeDelay)
+	}
+	s.postponed[key] = postponement{until: now.Add(delay), delay: delay}
+	return delay
+}
+
+// ready reports whether the benchmark is not postponed at the moment
+func (s *System) ready(benchmark BenchmarkInfo, now time.Time) bool {
+	postponed, ok := s.postponed[fmt.Sprint(benchmark)]
+	return !ok || !now.Before(postponed.until)
 }
 
 type Loaded struct {
@@ -36,39 +73,72 @@ type Loaded struct {
 }
 
 type SysInfo struct {
-	Arch     string
-	Hostname string
-	Platform string
-	CPUCount int
-	CPUFreq  float64
-	RAM      float64
+	Arch      string
+	Hostname  string
+	Platform  string
+	Kernel    string
+	CPUCount  int
+	CPUFreq   float64
+	CPUModel  string
+	Microcode string
+	RAM       float64
+	// Environment holds env.* parameters captured by CaptureEnvironment
+	Environment map[string]string
 }
 
-func HostStat() SysInfo {
-	hostStat, _ := host.Info()
-	cpuStat, _ := cpu.Info()
-	vmStat, _ := mem.VirtualMemory()
+// HostStat collects host information; errors of the individual probes are joined and the info is filled partially
+func HostStat() (SysInfo, error) {
+	info := SysInfo{Arch: runtime.GOARCH}
+	var errs []error
+	hostStat, err := host.Info()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("host info: %w", err))
+	}
+	if hostStat != nil {
+		info.Hostname = hostStat.Hostname
+		info.Platform = hostStat.Platform
+		info.Kernel = hostStat.KernelVersion
+	}
+	cpuStat, err := cpu.Info()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("cpu info: %w", err))
+	}
 	totalFreq := 0.0
 	for _, cpu := range cpuStat {
 		totalFreq += cpu.Mhz
 	}
-	info := SysInfo{
-		Arch:     runtime.GOARCH,
-		Hostname: hostStat.Hostname,
-		Platform: hostStat.Platform,
-		CPUCount: len(cpuStat),
-		CPUFreq:  totalFreq / float64(len(cpuStat)) * 1000,
-		RAM:      float64(vmStat.Total) / 1024 / 1024 / 1024,
+	if len(cpuStat) > 0 {
+		info.CPUCount = len(cpuStat)
+		info.CPUFreq = totalFreq / float64(len(cpuStat)) * 1000
+		info.CPUModel = cpuStat[0].ModelName
+		info.Microcode = cpuStat[0].Microcode
+	}
+	vmStat, err := mem.VirtualMemory()
+	if err != nil {
+		errs = append(errs, fmt.Errorf("memory info: %w", err))
+	} else {
+		info.RAM = float64(vmStat.Total) / 1024 / 1024 / 1024
 	}
-	return info
+	return info, errors.Join(errs...)
 }
 
 func (s *System) Run(ctx context.Context) error {
 	Logger.Infof("start benchmark")
 
-	info := HostStat()
+	info, err := HostStat()
+	if err != nil {
+		Logger.Warnf("host stat is incomplete: %v", err)
+	}
+	info.Environment, err = CaptureEnvironment(info, s.path)
+	if err != nil {
+		Logger.Warnf("environment is incomplete: %v", err)
+	}
 	Logger.Infof("host stat: %+v", info)
 
+	if err := s.benchmark.Isolation.Setup(); err != nil {
+		return fmt.Errorf("failed to setup isolation: %w", err)
+	}
+
 	meta, err := s.storage.ConnectDb(s.meta)
 	if err != nil {
 		return err
@@ -79,21 +149,9 @@ func (s *System) Run(ctx context.Context) error {
 		return err
 	}
 
-	if s.initialized == nil {
-		s.initialized = make(map[string]Loaded, 0)
-	}
-
 	for _, dataset := range s.datatsets {
-		if _, ok := s.initialized[dataset.Name()]; !ok {
-			datasetPath := path.Join(s.path, fmt.Sprintf("dataset-%v.db", dataset.Name()))
-			Logger.Infof("started dataset %v initialization at %v", dataset.Name(), datasetPath)
-			queries, err := dataset.Load(datasetPath)
-			Logger.Infof("finished dataset %v initialization at %v", dataset.Name(), datasetPath)
-
-			if err != nil {
-				return fmt.Errorf("failed to initialize dataset %v: %w", dataset.Name(), err)
-			}
-			s.initialized[dataset.Name()] = Loaded{Path: datasetPath, Queries: queries}
+		if _, err := s.LoadDataset(dataset); err != nil {
+			return err
 		}
 	}
 
@@ -104,19 +162,32 @@ func (s *System) Run(ctx context.Context) error {
 		} else {
 			Logger.Infof("loaded %v benchmarks to run", len(benchmarks))
 		}
+		executed := 0
 		for _, benchmark := range benchmarks {
+			if !s.ready(benchmark, time.Now()) {
+				continue
+			}
+			executed++
 			err = s.RunBechmark(meta, info, benchmark)
+			var noiseErr *NoiseError
+			if errors.As(err, &noiseErr) {
+				// postponed benchmark does not block the queue: it is retried with exponential backoff
+				Logger.Warnf("benchmark %v is postponed for %v: %v", benchmark, s.postpone(benchmark, time.Now()), err)
+				err = nil
+				continue
+			}
 			if err != nil {
 				Logger.Errorf("failed to execute benchmark %v: %v", benchmark, err)
 				break
 			}
+			delete(s.postponed, fmt.Sprint(benchmark))
 		}
 		if err != nil {
 			select {
 			case <-time.NewTimer(s.errorDelay).C:
 			case <-ctx.Done():
 			}
-		} else if len(benchmarks) == 0 {
+		} else if executed == 0 {
 			select {
 			case <-time.NewTimer(s.sleepDelay).C:
 			case <-ctx.Done():
@@ -127,12 +198,56 @@ func (s *System) Run(ctx context.Context) error {
 	return nil
 }
 
+// fingerprinted returns environment together with the isolation parameters (see EnvironmentFingerprint)
+func (s *System) fingerprinted(environment map[string]string) map[string]string {
+	fingerprinted := maps.Clone(environment)
+	if fingerprinted == nil {
+		fingerprinted = make(map[string]string)
+	}
+	for name, value := range s.benchmark.Isolation.Parameters() {
+		fingerprinted[name] = fmt.Sprint(value)
+	}
+	return fingerprinted
+}
+
+// LoadDataset initializes dataset in the runner directory (only once per process)
+func (s *System) LoadDataset(dataset Dataset) (Loaded, error) {
+	if s.initialized == nil {
+		s.initialized = make(map[string]Loaded, 0)
+	}
+	if loaded, ok := s.initialized[dataset.Name()]; ok {
+		return loaded, nil
+	}
+	datasetPath := path.Join(s.path, fmt.Sprintf("dataset-%v.db", dataset.Name()))
+	Logger.Infof("started dataset %v initialization at %v", dataset.Name(), datasetPath)
+	queries, err := dataset.Load(datasetPath)
+	Logger.Infof("finished dataset %v initialization at %v", dataset.Name(), datasetPath)
+
+	if err != nil {
+		return Loaded{}, fmt.Errorf("failed to initialize dataset %v: %w", dataset.Name(), err)
+	}
+	s.initialized[dataset.Name()] = Loaded{Path: datasetPath, Queries: queries}
+	return s.initialized[dataset.Name()], nil
+}
+
 func (s *System) RunBechmark(meta *sql.DB, info SysInfo, benchmark BenchmarkInfo) error {
 	Logger.Infof("running benchmark %v", benchmark)
 
 	var err error
 	var resultsDb, profilesDb *sql.DB
 	resultsName, profilesName := benchmark.Results, benchmark.Profiles
+	seed := s.benchmark.Seed
+	if seed == 0 {
+		seed = time.Now().UnixNano()
+	}
+	profiling := benchmark.Profiling
+	if profiling == "" {
+		profiling = s.benchmark.Profiling
+	}
+	if err := ValidateProfiling(profiling); err != nil {
+		return err
+	}
+	caches := CacheModesFor(s.benchmark.CacheModes, benchmark.Dataset)
 
 	if resultsName == "" && profilesName == "" {
 		revisionShort := benchmark.Revision[0:min(8, len(benchmark.Revision))]
@@ -156,18 +271,32 @@ func (s *System) RunBechmark(meta *sql.DB, info SysInfo, benchmark BenchmarkInfo
 		if err != nil {
 			return fmt.Errorf("unable to connect to the profiles benchmark db %v: %w", profilesName, err)
 		}
-		err = s.storage.InitResultsDb(resultsDb, map[string]any{
-			"runner":   s.id,
-			"repo":     benchmark.Repo,
-			"branch":   benchmark.Branch,
-			"revision": benchmark.Revision,
-			"arch":     info.Arch,
-			"hostname": info.Hostname,
-			"platform": info.Platform,
-			"ram":      info.RAM,
-			"cpu":      info.CPUCount,
-			"freq":     info.CPUFreq,
-		})
+		parameters := map[string]any{
+			"runner":      s.id,
+			"repo":        benchmark.Repo,
+			"branch":      benchmark.Branch,
+			"revision":    benchmark.Revision,
+			"compare":     strings.Join(benchmark.Compare, ","),
+			"order":       s.benchmark.Order,
+			"seed":        seed,
+			"profiling":   profiling,
+			"cache":       strings.Join(caches, ","),
+			"timeout":     s.benchmark.Timeout.Seconds(),
+			"arch":        info.Arch,
+			"hostname":    info.Hostname,
+			"platform":    info.Platform,
+			"ram":         info.RAM,
+			"cpu":         info.CPUCount,
+			"freq":        info.CPUFreq,
+			"fingerprint": EnvironmentFingerprint(s.fingerprinted(info.Environment)),
+		}
+		for name, value := range info.Environment {
+			parameters[name] = value
+		}
+		for name, value := range s.benchmark.Isolation.Parameters() {
+			parameters[name] = value
+		}
+		err = s.storage.InitResultsDb(resultsDb, parameters)
 		if err != nil {
 			return fmt.Errorf("unable to initialize benchmark results db %v: %w", resultsName, err)
 		}
@@ -193,11 +322,23 @@ func (s *System) RunBechmark(meta *sql.DB, info SysInfo, benchmark BenchmarkInfo
 		if parameters["runner"] != s.id {
 			return fmt.Errorf("another runner already started evaluation of the benchmark %v", resultsName)
 		}
+		if stored, err := strconv.ParseInt(parameters["seed"], 10, 64); err == nil {
+			seed = stored
+		}
+		err = s.storage.MigrateResultsDb(resultsDb)
+		if err != nil {
+			return fmt.Errorf("unable to migrate results benchmark db %v: %w", resultsName, err)
+		}
 
 		profilesDb, err = s.storage.ConnectDb(profilesName)
 		if err != nil {
 			return fmt.Errorf("unable to connect to the profiles benchmark db %v: %w", profilesName, err)
 		}
+		// profiles db of the benchmark started by older version can miss chunked profile tables
+		err = s.storage.InitProfilesDb(profilesDb)
+		if err != nil {
+			return fmt.Errorf("unable to initialize benchmark profiles db %v: %w", profilesName, err)
+		}
 	}
 
 	var target Dataset
@@ -212,38 +353,154 @@ func (s *System) RunBechmark(meta *sql.DB, info SysInfo, benchmark BenchmarkInfo
 
 	loaded := s.initialized[target.Name()]
 
+	// every runner initialized for every compared revision: runners which do not depend on the revision
+	// produce instances with the same name and only the first of them is used
 	runners := make([]Instance, 0)
+	names := make(map[string]bool, 0)
 	for _, factory := range s.runners {
-		runner, err := factory.Init(benchmark)
-		if err != nil {
-			return fmt.Errorf("failed to initialize runner %v for %v: %w", factory.Name(), benchmark, err)
+		for _, revision := range benchmark.Revisions() {
+			target := benchmark
+			target.Revision = revision
+			runner, err := factory.Init(target)
+			var buildErr *BuildError
+			if errors.As(err, &buildErr) {
+				_, uploadErr := s.storage.UploadProfileDb(profilesDb, BenchmarkProfile{
+					Runner:  factory.Name(),
+					Dataset: benchmark.Dataset,
+					Name:    BuildName,
+					Files:   []string{buildErr.Log},
+				})
+				if uploadErr != nil {
+					Logger.Errorf("failed to upload build log %v: %v", buildErr.Log, uploadErr)
+				}
+			}
+			if err != nil {
+				return fmt.Errorf("failed to initialize runner %v for %v: %w", factory.Name(), target, err)
+			}
+			if names[runner.Name()] {
+				continue
+			}
+			names[runner.Name()] = true
+			runners = append(runners, runner)
+
+			if parametrized, ok := runner.(Parametrized); ok {
+				parameters, err := parametrized.Parameters()
+				if err != nil {
+					return fmt.Errorf("failed to fetch parameters of runner %v for %v: %w", runner.Name(), benchmark, err)
+				}
+				err = s.storage.AddParameters(resultsDb, parameters)
+				if err != nil {
+					return fmt.Errorf("failed to store parameters of runner %v for %v: %w", runner.Name(), benchmark, err)
+				}
+			}
+		}
+	}
+
+	// cache is collected only after all revisions are built so binaries of the compared revisions are kept
+	for _, factory := range s.runners {
+		if collector, ok := factory.(Collector); ok {
+			if err := collector.Collect(runners); err != nil {
+				return fmt.Errorf("failed to collect build cache of runner %v: %w", factory.Name(), err)
+			}
 		}
-		runners = append(runners, runner)
 	}
 
 	written, err := s.storage.WrittenQueries(resultsDb, benchmark, benchmark.Dataset)
 	if err != nil {
 		return fmt.Errorf("failed to fetch written queries for %v: %w", benchmark, err)
 	}
-	for _, query := range loaded.Queries {
-		if written[query.Name] {
-			continue
+	if !written[BuildName] {
+		results, profiles := BuildResults(benchmark, runners)
+		err = s.storage.UpdateBenchmarkDb(resultsDb, results)
+		if err != nil {
+			return fmt.Errorf("failed to update build results %v: %w", benchmark, err)
 		}
-		results, profiles, err := s.ExecuteBenchmark(benchmark, loaded.Path, query, runners)
+		err = s.uploadProfiles(resultsDb, profilesDb, benchmark, profiles)
 		if err != nil {
-			return fmt.Errorf("failed to execute benchmark %v: %w", benchmark, err)
+			return fmt.Errorf("failed to upload build logs %v: %w", benchmark, err)
 		}
+	}
+	if s.benchmark.Noise.Enabled() {
+		record, err := s.benchmark.CheckNoise(benchmark.Dataset, PreflightName)
+		if err := s.recordNoise(resultsDb, record, err); err != nil {
+			return fmt.Errorf("pre-flight noise check failed for %v: %w", benchmark, err)
+		}
+	}
+	// startup time depends on the cache state as well, so baseline is measured separately for every cache mode
+	baselines := make(map[string]map[string]float64, len(caches))
+	for _, cache := range caches {
+		name := CacheQueryName(BaselineQuery.Name, cache)
+		if !written[name] {
+			results, err := s.ExecuteBaseline(benchmark, loaded.Path, runners, cache)
+			if err != nil {
+				return fmt.Errorf("failed to execute baseline %v: %w", benchmark, err)
+			}
+			err = s.storage.UpdateBenchmarkDb(resultsDb, results)
+			if err != nil {
+				return fmt.Errorf("failed to update baseline results %v: %w", benchmark, err)
+			}
+		}
+		samples, err := s.storage.Measurements(resultsDb, benchmark.Dataset, name, MeasurementTotalTime)
+		if err != nil {
+			return fmt.Errorf("failed to fetch baseline results %v: %w", benchmark, err)
+		}
+		baseline := make(map[string]float64, len(samples))
+		for runner, values := range samples {
+			baseline[runner] = median(values)
+		}
+		baselines[cache] = baseline
+		Logger.Infof("baseline startup time for dataset %v with %v cache: %v", benchmark.Dataset, cache, baseline)
+	}
 
-		err = s.storage.UpdateBenchmarkDb(resultsDb, results)
+	queries := CacheQueries(loaded.Queries, caches)
+	pending := make([]Query, 0)
+	for _, query := range queries {
+		if !written[query.Name] {
+			pending = append(pending, query)
+		}
+	}
+	err = s.ExecuteQueries(benchmark, loaded.Path, pending, runners, seed, profiling, func(results []BenchmarkResult, profiles []BenchmarkProfile, noise []NoiseRecord, warnings []Warning) error {
+		if s.benchmark.NetTime && len(results) > 0 {
+			// all results of the flushed query are measured with the same cache mode
+			results = append(results, NetTimeResults(results, warnings, baselines[results[0].Cache])...)
+		}
+		err := s.storage.UpdateBenchmarkDb(resultsDb, results)
 		if err != nil {
 			return fmt.Errorf("failed to update benchmark results %v: %w", benchmark, err)
 		}
-		for _, profile := range profiles {
-			err = s.storage.UploadProfileDb(profilesDb, profile)
-			if err != nil {
-				return fmt.Errorf("failed to upload profile results %v: %w", benchmark, err)
+		for _, record := range noise {
+			if err := s.storage.AddNoise(resultsDb, record); err != nil {
+				return fmt.Errorf("failed to record noise %v: %w", benchmark, err)
+			}
+		}
+		for _, warning := range warnings {
+			if err := s.storage.AddWarning(resultsDb, warning.Runner, benchmark.Dataset, warning.Name, warning.Message); err != nil {
+				return fmt.Errorf("failed to add warning %v: %w", benchmark, err)
 			}
 		}
+		return s.uploadProfiles(resultsDb, profilesDb, benchmark, profiles)
+	})
+	var noiseErr *NoiseError
+	if errors.As(err, &noiseErr) {
+		if recordErr := s.storage.AddNoise(resultsDb, noiseErr.Record); recordErr != nil {
+			Logger.Errorf("failed to record noise of query %v: %v", noiseErr.Record.Name, recordErr)
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to execute benchmark %v: %w", benchmark, err)
+	}
+
+	if profiling == ProfilingRegressed {
+		err = s.ProfileRegressed(meta, resultsDb, profilesDb, benchmark, Loaded{Path: loaded.Path, Queries: queries}, runners)
+		if err != nil {
+			return fmt.Errorf("failed to profile regressed queries %v: %w", benchmark, err)
+		}
+	}
+
+	benchmark.Results, benchmark.Profiles = resultsName, profilesName
+	err = AppendHistory(&s.storage, meta, resultsDb, benchmark, &s.commitTimes)
+	if err != nil {
+		return fmt.Errorf("failed to append history of benchmark %v: %w", benchmark, err)
 	}
 
 	err = s.storage.FinishBenchmark(meta, benchmark)
@@ -254,78 +511,412 @@ func (s *System) RunBechmark(meta *sql.DB, info SysInfo, benchmark BenchmarkInfo
 	return nil
 }
 
-func (s *System) ExecuteBenchmark(
-	benchmark BenchmarkInfo,
-	path string,
-	query Query,
-	runners []Instance,
-) ([]BenchmarkResult, []BenchmarkProfile, error) {
+// BuildResults collects build time and binary size measurements together with build logs of the runners built from sources
+func BuildResults(benchmark BenchmarkInfo, runners []Instance) ([]BenchmarkResult, []BenchmarkProfile) {
 	results := make([]BenchmarkResult, 0)
 	profiles := make([]BenchmarkProfile, 0)
-	type linesInfo struct {
-		runner string
-		lines  []string
-	}
-	runnerLines := make([]linesInfo, 0)
 	for _, runner := range runners {
-		if len(query.Runners) > 0 && !slices.Contains(query.Runners, runner.Name()) {
-			// add fake result for now
+		built, ok := runner.(Built)
+		if !ok {
+			continue
+		}
+		build := built.Build()
+		if build.Duration > 0 {
 			results = append(results, BenchmarkResult{
-				Runner:    runner.Name(),
-				Dataset:   benchmark.Dataset,
-				Name:      query.Name,
-				TotalTime: 0,
-				Attempts:  1,
+				Runner:      runner.Name(),
+				Dataset:     benchmark.Dataset,
+				Name:        BuildName,
+				Measurement: MeasurementBuildTime,
+				TotalTime:   build.Duration,
+				Attempts:    1,
 			})
-			continue
 		}
-		Logger.Infof("running query %v/%v with runner %v", benchmark.Dataset, query.Name, runner.Name())
-		cmd := runner.RunCmd(path, query.Query)
-		err := s.benchmark.WarmupCmd(cmd)
-		if err != nil {
-			return nil, nil, fmt.Errorf("failed to warmup benchmark in runner %v for query %v: %w", runner.Name(), query.Name, err)
+		results = append(results, BenchmarkResult{
+			Runner:      runner.Name(),
+			Dataset:     benchmark.Dataset,
+			Name:        BuildName,
+			Measurement: MeasurementBinarySize,
+			TotalTime:   float64(build.Size),
+			Attempts:    1,
+		})
+		if build.Log != "" {
+			profiles = append(profiles, BenchmarkProfile{
+				Runner:  runner.Name(),
+				Dataset: benchmark.Dataset,
+				Name:    BuildName,
+				Files:   []string{build.Log},
+			})
 		}
-		local, lines, err := s.benchmark.RunCmd(cmd)
+	}
+	return results, profiles
+}
+
+// recordNoise stores noise record even if the check failed with NoiseError
+func (s *System) recordNoise(resultsDb *sql.DB, record NoiseRecord, checkErr error) error {
+	var noiseErr *NoiseError
+	if checkErr != nil && !errors.As(checkErr, &noiseErr) {
+		return checkErr
+	}
+	if err := s.storage.AddNoise(resultsDb, record); err != nil {
+		return err
+	}
+	return checkErr
+}
+
+func (s *System) ExecuteBaseline(benchmark BenchmarkInfo, path string, runners []Instance, cache string) ([]BenchmarkResult, error) {
+	results := make([]BenchmarkResult, 0)
+	name := CacheQueryName(BaselineQuery.Name, cache)
+	for _, runner := range runners {
+		Logger.Infof("running baseline %v/%v with runner %v", benchmark.Dataset, name, runner.Name())
+		cmd := runner.RunCmd(path, BaselineQuery.Query)
+		err := s.benchmark.WarmupCmd(cmd)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to run benchmark in runner %v for query %v: %w", runner.Name(), query.Name, err)
+			return nil, fmt.Errorf("failed to warmup baseline in runner %v: %w", runner.Name(), err)
 		}
-		files, err := s.benchmark.ProfileCmd(cmd)
+		local, _, err := s.benchmark.RunCmd(cmd, cache, path)
 		if err != nil {
-			return nil, nil, fmt.Errorf("failed to run profile in runner %v for query %v: %w", runner.Name(), query.Name, err)
+			return nil, fmt.Errorf("failed to run baseline in runner %v: %w", runner.Name(), err)
 		}
-		runnerLines = append(runnerLines, linesInfo{runner: runner.Name(), lines: lines})
 		for _, result := range local {
 			results = append(results, BenchmarkResult{
-				Runner:    runner.Name(),
-				Dataset:   benchmark.Dataset,
-				Name:      query.Name,
-				TotalTime: result.TotalTime,
-				Attempts:  result.Attempts,
+				Runner:      runner.Name(),
+				Dataset:     benchmark.Dataset,
+				Name:        name,
+				Measurement: MeasurementTotalTime,
+				TotalTime:   result.TotalTime,
+				Attempts:    result.Attempts,
+				Cache:       result.Cache,
 			})
 		}
+	}
+	return results, nil
+}
+
+func (s *System) ProfileQuery(benchmark BenchmarkInfo, path string, query Query, runner Instance) BenchmarkProfile {
+	profile := BenchmarkProfile{Runner: runner.Name(), Dataset: benchmark.Dataset, Name: query.Name, Temporary: true}
+	profiler := ProfilerFor(s.benchmark.Profilers, runner, benchmark.Dataset)
+	title := fmt.Sprintf("%v %v/%v", runner.Name(), benchmark.Dataset, query.Name)
+	files, err := s.benchmark.ProfileCmd(profiler, runner.RunCmd(path, query.Query), title, query.Cache, path)
+	if err != nil {
+		Logger.Warnf("failed to run %v profile in runner %v for query %v: %v", profiler.Name(), runner.Name(), query.Name, err)
+		profile.Warning = fmt.Sprintf("%v profiler failed: %v", profiler.Name(), err)
+	}
+	profile.Files = files
+	return profile
+}
+
+func (s *System) uploadProfiles(resultsDb, profilesDb *sql.DB, benchmark BenchmarkInfo, profiles []BenchmarkProfile) error {
+	for _, profile := range profiles {
+		if profile.Warning != "" {
+			err := s.storage.AddWarning(resultsDb, profile.Runner, profile.Dataset, profile.Name, profile.Warning)
+			if err != nil {
+				return fmt.Errorf("failed to add warning %v: %w", benchmark, err)
+			}
+		}
+		skipped, err := s.storage.UploadProfileDb(profilesDb, profile)
+		if err != nil {
+			return fmt.Errorf("failed to upload profile results %v: %w", benchmark, err)
+		}
+		// skipped files are kept locally so the profile is not lost
+		kept := make(map[string]bool, len(skipped))
+		for _, skip := range skipped {
+			kept[skip.File] = true
+			location, err := filepath.Abs(skip.File)
+			if err != nil {
+				location = skip.File
+			}
+			warning := fmt.Sprintf("%v, kept at %v", skip.Reason, location)
+			Logger.Warnf("profile of runner %v for query %v/%v skipped: %v", profile.Runner, profile.Dataset, profile.Name, warning)
+			err = s.storage.AddWarning(resultsDb, profile.Runner, profile.Dataset, profile.Name, warning)
+			if err != nil {
+				return fmt.Errorf("failed to add warning %v: %w", benchmark, err)
+			}
+		}
+		if profile.Temporary {
+			for _, file := range profile.Files {
+				if kept[file] {
+					continue
+				}
+				if err := os.Remove(file); err != nil && !errors.Is(err, os.ErrNotExist) {
+					Logger.Warnf("failed to remove local profile file %v: %v", file, err)
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// ProfileRegressed profiles runners which median time for the query exceeds median of the baseline benchmark
+func (s *System) ProfileRegressed(
+	meta *sql.DB,
+	resultsDb *sql.DB,
+	profilesDb *sql.DB,
+	benchmark BenchmarkInfo,
+	loaded Loaded,
+	runners []Instance,
+) error {
+	parameters, err := s.storage.Parameters(resultsDb)
+	if err != nil {
+		return err
+	}
+	baseline, err := FindComparableBaseline(&s.storage, meta, benchmark, parameters, s.benchmark.BaselineBranch)
+	if errors.Is(err, ErrBaselineNotFound) {
+		Logger.Infof("%v, skip profiling", err)
+		return nil
+	} else if err != nil {
+		return err
+	}
+	baselineDb, err := s.storage.ConnectDb(baseline.Results)
+	if err != nil {
+		return err
+	}
+	defer baselineDb.Close()
+	for _, query := range loaded.Queries {
+		current, err := s.storage.Measurements(resultsDb, benchmark.Dataset, query.Name, MeasurementTotalTime)
+		if err != nil {
+			return err
+		}
+		previous, err := s.storage.Measurements(baselineDb, benchmark.Dataset, query.Name, MeasurementTotalTime)
+		if err != nil {
+			return err
+		}
+		profiles := make([]BenchmarkProfile, 0)
+		for _, runner := range runners {
+			if len(query.Runners) > 0 && !slices.Contains(query.Runners, EngineName(runner)) {
+				continue
+			}
+			before, after := median(baselineSamples(previous, runner, baseline)), median(current[runner.Name()])
+			if before == 0 || after <= before*(1+s.benchmark.RegressionThreshold) {
+				continue
+			}
+			Logger.Infof("query %v/%v regressed in runner %v: %v -> %v", benchmark.Dataset, query.Name, runner.Name(), before, after)
+			profiles = append(profiles, s.ProfileQuery(benchmark, loaded.Path, query, runner))
+		}
+		err = s.uploadProfiles(resultsDb, profilesDb, benchmark, profiles)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// baselineSamples returns samples of the runner in the baseline results: compare labels (see InstanceTurso.Label) are
+// stripped so labeled runner matches the runner of the plain baseline as well as the runner labeled with the baseline revision
+func baselineSamples(previous map[string][]float64, runner Instance, baseline BenchmarkInfo) []float64 {
+	name := runner.Name()
+	if turso, ok := runner.(*InstanceTurso); ok && turso.Label != "" {
+		unlabeled := *turso
+		unlabeled.Label = ""
+		name = unlabeled.Name()
+	}
+	if samples, ok := previous[name]; ok {
+		return samples
+	}
+	return previous[fmt.Sprintf("%v-%v", name, shortRevision(baseline.Revision))]
+}
+
+// WarningMismatch prefixes warnings recorded for the queries which output differs between runners
+const WarningMismatch = "results mismatch"
+
+// MismatchError reports query which output of the Runner differs from the output of the Expected runner
+type MismatchError struct {
+	Query    string
+	Runner   string
+	Expected string
+	Detail   string
+}
+
+func (e *MismatchError) Error() string {
+	return fmt.Sprintf("%v for runners %v and %v: %v", WarningMismatch, e.Expected, e.Runner, e.Detail)
+}
 
-		profiles = append(profiles, BenchmarkProfile{
-			Runner:  runner.Name(),
-			Dataset: benchmark.Dataset,
-			Name:    query.Name,
-			Files:   files,
+// RunnerOutput keeps output lines of the query produced by the runner
+type RunnerOutput struct {
+	Runner string
+	Lines  []string
+}
+
+// MatchOutputs compares outputs of the runners with the output of the first one (only line counts are compared if
+// Query.MatchOnlyCount is set) and returns mismatch for every runner which output differs
+func MatchOutputs(query Query, outputs []RunnerOutput) []*MismatchError {
+	mismatches := make([]*MismatchError, 0)
+	for i := 1; i < len(outputs); i++ {
+		first, current := outputs[0], outputs[i]
+		if !query.MatchOnlyCount && slices.Equal(first.Lines, current.Lines) {
+			continue
+		}
+		if query.MatchOnlyCount && len(first.Lines) == len(current.Lines) {
+			continue
+		}
+		mismatches = append(mismatches, &MismatchError{
+			Query:    query.Name,
+			Runner:   current.Runner,
+			Expected: first.Runner,
+			Detail:   fmt.Sprintf("%+v != %+v", first.Lines, current.Lines),
 		})
 	}
-	for i := 1; i < len(runnerLines); i++ {
-		if !query.MatchOnlyCount && slices.Equal(runnerLines[0].lines, runnerLines[i].lines) {
+	return mismatches
+}
+
+// WarningSkipped is recorded for the runners which do not support the query (see Query.Runners)
+const WarningSkipped = "not supported by the runner"
+
+// ExecuteQueries runs all queries with all runners in the order configured by the Benchmark.Order
+// and calls flush with the results of every query as soon as all its attempts are finished;
+// mismatches of the output and timeouts do not stop the benchmark and are flushed as warnings of the query
+func (s *System) ExecuteQueries(
+	benchmark BenchmarkInfo,
+	path string,
+	queries []Query,
+	runners []Instance,
+	seed int64,
+	profiling string,
+	flush func([]BenchmarkResult, []BenchmarkProfile, []NoiseRecord, []Warning) error,
+) error {
+	type queryState struct {
+		results   []BenchmarkResult
+		profiles  []BenchmarkProfile
+		noise     []NoiseRecord
+		warnings  []Warning
+		outputs   map[int]RunnerOutput
+		active    []int
+		remaining int
+	}
+	states := make([]queryState, len(queries))
+	pairs := make([]Pair, 0)
+	for q, query := range queries {
+		states[q].outputs = make(map[int]RunnerOutput, 0)
+		for r, runner := range runners {
+			if len(query.Runners) > 0 && !slices.Contains(query.Runners, EngineName(runner)) {
+				// add fake result for now
+				states[q].results = append(states[q].results, BenchmarkResult{
+					Runner:      runner.Name(),
+					Dataset:     benchmark.Dataset,
+					Name:        query.Name,
+					Measurement: MeasurementTotalTime,
+					TotalTime:   0,
+					Attempts:    1,
+					Cache:       query.Cache,
+				})
+				states[q].warnings = append(states[q].warnings, Warning{Runner: runner.Name(), Name: query.Name, Message: WarningSkipped})
+				continue
+			}
+			states[q].active = append(states[q].active, r)
+			pairs = append(pairs, Pair{Query: q, Runner: r})
+		}
+		states[q].remaining = len(states[q].active)
+	}
+	// attempts of different cache modes never interleave, otherwise cold attempts would evict caches of the hot ones
+	steps, err := PlanGroups(s.benchmark.Order, pairs, func(pair Pair) string { return queries[pair.Query].Cache }, s.benchmark.Attempts, seed)
+	if err != nil {
+		return err
+	}
+	Logger.Infof("planned %v steps for %v queries with order %v and seed %v", len(steps), len(queries), s.benchmark.Order, seed)
+
+	finish := func(q int) error {
+		query, state := queries[q], states[q]
+		outputs := make([]RunnerOutput, 0, len(state.active))
+		for _, r := range state.active {
+			outputs = append(outputs, state.outputs[r])
+		}
+		for _, mismatch := range MatchOutputs(query, outputs) {
+			Logger.Errorf("query %v/%v failed: %v", benchmark.Dataset, query.Name, mismatch)
+			state.warnings = append(state.warnings, Warning{Runner: mismatch.Runner, Name: query.Name, Message: mismatch.Error()})
+		}
+		return flush(state.results, state.profiles, state.noise, state.warnings)
+	}
+	// timeout excludes the runner from the query: its remaining attempts are skipped and partial results dropped
+	timedOut := make(map[Pair]bool, 0)
+	timeout := func(step Step, err error) error {
+		query, runner, state := queries[step.Query], runners[step.Runner], &states[step.Query]
+		Logger.Errorf("query %v/%v failed in runner %v: %v", benchmark.Dataset, query.Name, runner.Name(), err)
+		timedOut[step.Pair] = true
+		state.results = slices.DeleteFunc(state.results, func(result BenchmarkResult) bool { return result.Runner == runner.Name() })
+		state.active = slices.DeleteFunc(state.active, func(r int) bool { return r == step.Runner })
+		state.warnings = append(state.warnings, Warning{Runner: runner.Name(), Name: query.Name, Message: err.Error()})
+		state.remaining--
+		if state.remaining == 0 {
+			return finish(step.Query)
+		}
+		return nil
+	}
+	for q := range queries {
+		if states[q].remaining == 0 {
+			if err := finish(q); err != nil {
+				return err
+			}
+		}
+	}
+
+	warmed := make(map[Pair]bool, 0)
+	for _, step := range steps {
+		query, runner, state := queries[step.Query], runners[step.Runner], &states[step.Query]
+		if timedOut[step.Pair] {
 			continue
 		}
-		if query.MatchOnlyCount && len(runnerLines[0].lines) == len(runnerLines[i].lines) {
+		if s.benchmark.Noise.Enabled() && len(state.noise) == 0 {
+			record, err := s.benchmark.CheckNoise(benchmark.Dataset, query.Name)
+			if err != nil {
+				return err
+			}
+			state.noise = append(state.noise, record)
+		}
+		cmd := runner.RunCmd(path, query.Query)
+		if !warmed[step.Pair] {
+			warmed[step.Pair] = true
+			Logger.Infof("warmup query %v/%v with runner %v", benchmark.Dataset, query.Name, runner.Name())
+			err := s.benchmark.WarmupCmd(cmd)
+			var timeoutErr *TimeoutError
+			if errors.As(err, &timeoutErr) {
+				if err := timeout(step, timeoutErr); err != nil {
+					return err
+				}
+				continue
+			}
+			if err != nil {
+				return fmt.Errorf("failed to warmup benchmark in runner %v for query %v: %w", runner.Name(), query.Name, err)
+			}
+		}
+
+		Logger.Infof("running query %v/%v with runner %v", benchmark.Dataset, query.Name, runner.Name())
+		result, lines, err := s.benchmark.RunAttempt(cmd, step.Attempt, query.Cache, path)
+		var timeoutErr *TimeoutError
+		if errors.As(err, &timeoutErr) {
+			if err := timeout(step, timeoutErr); err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("failed to run benchmark in runner %v for query %v: %w", runner.Name(), query.Name, err)
+		}
+		if normalizer, ok := runner.(Normalizer); ok {
+			lines = normalizer.Normalize(lines)
+		}
+		lines = NormalizeNumbers(lines)
+		state.outputs[step.Runner] = RunnerOutput{Runner: runner.Name(), Lines: lines}
+		state.results = append(state.results, BenchmarkResult{
+			Runner:      runner.Name(),
+			Dataset:     benchmark.Dataset,
+			Name:        query.Name,
+			Measurement: MeasurementTotalTime,
+			TotalTime:   result.TotalTime,
+			Attempts:    result.Attempts,
+			Cache:       result.Cache,
+		})
+		if step.Attempt+1 < s.benchmark.Attempts {
 			continue
 		}
-		err := fmt.Errorf(
-			"results are different for runners %v and %v: %+v != %+v",
-			runnerLines[0].runner,
-			runnerLines[i].runner,
-			runnerLines[0].lines,
-			runnerLines[i].lines,
-		)
-		return nil, nil, err
+
+		if ShouldProfile(profiling, runner) {
+			state.profiles = append(state.profiles, s.ProfileQuery(benchmark, path, query, runner))
+		}
+		state.remaining--
+		if state.remaining == 0 {
+			if err := finish(step.Query); err != nil {
+				return err
+			}
+		}
 	}
-	return results, profiles, nil
+	return nil
 }
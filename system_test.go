@@ -0,0 +1,35 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestMatchOutputs(t *testing.T) {
+	outputs := []RunnerOutput{
+		{Runner: "sqlite3", Lines: []string{"1", "2"}},
+		{Runner: "turso", Lines: []string{"1", "2"}},
+		{Runner: "duckdb", Lines: []string{"2", "1"}},
+	}
+	require.Empty(t, MatchOutputs(Query{Name: "q1", MatchOnlyCount: true}, outputs))
+
+	mismatches := MatchOutputs(Query{Name: "q1"}, outputs)
+	require.Len(t, mismatches, 1)
+	require.Equal(t, "duckdb", mismatches[0].Runner)
+	require.Equal(t, "sqlite3", mismatches[0].Expected)
+
+	// mismatch is recorded as a warning and measurements of the query are still reported
+	warnings := []Warning{{Runner: mismatches[0].Runner, Name: "q1", Message: mismatches[0].Error()}}
+	report := BuildDatasetReport(DatasetReport{Reference: "sqlite3"}, []string{"q1"}, map[string]ReportSamples{
+		"q1": {Measurement: MeasurementTotalTime, Target: map[string][]float64{"sqlite3": {1}, "turso": {2}, "duckdb": {3}}},
+	}, warnings, 0.05, 0.05)
+	require.Equal(t, []string{"duckdb"}, report.Queries[0].Mismatches)
+	for _, runner := range report.Queries[0].Runners {
+		require.False(t, runner.Missing)
+		require.Equal(t, 1, runner.Samples)
+	}
+
+	outputs[2].Lines = []string{"1"}
+	require.Len(t, MatchOutputs(Query{Name: "q1", MatchOnlyCount: true}, outputs), 1)
+}